@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+//Auth makes sure requests carry admin token as 'Authorization: Bearer <token>' header.
+//If token is empty, admin endpoints are disabled and all the requests are rejected
+func Auth(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+			if "" == token {
+				http.Error(w, "Admin API is disabled. Set ADMIN_TOKEN to enable it", http.StatusForbidden)
+				return
+			}
+			header := rq.Header.Get("Authorization")
+			if !strings.HasPrefix(header, "Bearer ") ||
+				1 != subtle.ConstantTimeCompare([]byte(token), []byte(strings.TrimPrefix(header, "Bearer "))) {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Incorrect admin token", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, rq)
+		})
+	}
+}
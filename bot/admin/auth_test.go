@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, c := range []struct {
+		name   string
+		token  string
+		header string
+		exp    int
+	}{
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"token without scheme", "secret", "secret", http.StatusUnauthorized},
+		{"no token", "secret", "", http.StatusUnauthorized},
+		{"disabled", "", "Bearer ", http.StatusForbidden},
+	} {
+		rq := httptest.NewRequest(http.MethodGet, "/api/v1/results/junit", nil)
+		if "" != c.header {
+			rq.Header.Set("Authorization", c.header)
+		}
+		rs := httptest.NewRecorder()
+		Auth(c.token)(ok).ServeHTTP(rs, rq)
+		if c.exp != rs.Code {
+			t.Errorf("%s: expected %d, got %d", c.name, c.exp, rs.Code)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//repoFactory creates empty repo and returns function releasing its resources
+type repoFactory func(t *testing.T) (SessionRepo, func())
+
+//testConformance runs tests every SessionRepo implementation must pass
+func testConformance(t *testing.T, newRepo repoFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo SessionRepo)
+	}{
+		{"CRUD", testCRUD},
+		{"UpdateFuncConcurrent", testUpdateFuncConcurrent},
+		{"UpdateFuncConflict", testUpdateFuncConflict},
+		{"Patch", testPatch},
+		{"IDs", testIDs},
+	}
+	for _, c := range tests {
+		t.Run(c.name, func(t *testing.T) {
+			repo, cleanup := newRepo(t)
+			defer cleanup()
+			c.test(t, repo)
+		})
+	}
+}
+
+func testCRUD(t *testing.T, repo SessionRepo) {
+	ctx := context.Background()
+	var s QuizSession
+	if err := repo.Load(ctx, "1", &s); ErrNotFound != err {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+
+	saved := &QuizSession{ID: "1", LaunchID: "launch", Results: map[int]bool{0: false}}
+	if err := repo.Save(ctx, saved); nil != err {
+		t.Fatal(err)
+	}
+	if err := repo.Load(ctx, "1", &s); nil != err {
+		t.Fatal(err)
+	}
+	if "launch" != s.LaunchID || 1 != len(s.Results) || 1 != s.Version {
+		t.Errorf("Unexpected session loaded: %+v", s)
+	}
+
+	//loaded session isn't shared with the repo
+	s.Results[1] = true
+	var reloaded QuizSession
+	repo.Load(ctx, "1", &reloaded)
+	if 1 != len(reloaded.Results) {
+		t.Error("Loaded session shares state with the repo")
+	}
+
+	if err := repo.Save(ctx, &QuizSession{ID: "1"}); nil != err {
+		t.Fatal(err)
+	}
+	repo.Load(ctx, "1", &reloaded)
+	if 2 != reloaded.Version || "" != reloaded.LaunchID {
+		t.Errorf("Expected session to be overwritten: %+v", reloaded)
+	}
+
+	if err := repo.Delete(ctx, "1"); nil != err {
+		t.Fatal(err)
+	}
+	if err := repo.Load(ctx, "1", &s); ErrNotFound != err {
+		t.Errorf("Expected session to be deleted, got %v", err)
+	}
+	if err := repo.Delete(ctx, "1"); nil != err {
+		t.Errorf("Expected deletion of missing session to succeed, got %v", err)
+	}
+}
+
+func testUpdateFuncConcurrent(t *testing.T, repo SessionRepo) {
+	ctx := context.Background()
+	if err := repo.Save(ctx, &QuizSession{ID: "1", Results: map[int]bool{}}); nil != err {
+		t.Fatal(err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := repo.UpdateFunc(ctx, "1", func(s *QuizSession) error {
+				s.Results[i] = true
+				return nil
+			})
+			//conflicts are expected to be resolved by retries, but the number of them is limited
+			if nil != err && ErrConflict != err {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var s QuizSession
+	if err := repo.Load(ctx, "1", &s); nil != err {
+		t.Fatal(err)
+	}
+	//each successful update is applied on top of the previous one
+	if s.Version-1 != len(s.Results) {
+		t.Errorf("Lost updates: version %d, results %d", s.Version, len(s.Results))
+	}
+}
+
+func testUpdateFuncConflict(t *testing.T, repo SessionRepo) {
+	ctx := context.Background()
+	if err := repo.Save(ctx, &QuizSession{ID: "1", TestID: "initial"}); nil != err {
+		t.Fatal(err)
+	}
+
+	attempts := 0
+	err := repo.UpdateFunc(ctx, "1", func(s *QuizSession) error {
+		attempts++
+		if 1 == attempts {
+			//session is changed while the first attempt is in progress
+			if err := repo.Save(ctx, &QuizSession{ID: "1", TestID: "concurrent"}); nil != err {
+				return err
+			}
+		}
+		s.State = "asking"
+		return nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != attempts {
+		t.Errorf("Expected changes to be re-applied once, got %d attempts", attempts)
+	}
+
+	var s QuizSession
+	repo.Load(ctx, "1", &s)
+	if "concurrent" != s.TestID || "asking" != s.State {
+		t.Errorf("Expected changes to be applied on top of concurrent ones: %+v", s)
+	}
+
+	fnErr := errors.New("answered")
+	if err := repo.UpdateFunc(ctx, "1", func(s *QuizSession) error { return fnErr }); fnErr != err {
+		t.Errorf("Expected error of the update function, got %v", err)
+	}
+	if err := repo.UpdateFunc(ctx, "2", func(s *QuizSession) error { return nil }); ErrNotFound != err {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func testPatch(t *testing.T, repo SessionRepo) {
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	full := QuizSession{
+		ID:              "1",
+		Questions:       []*opentdb.Question{{Question: "2+2"}},
+		LaunchID:        "launch",
+		SuiteID:         "suite",
+		TestID:          "test",
+		Suites:          map[string]string{"Science": "science"},
+		Options:         map[string]string{"token": "4"},
+		Results:         map[int]bool{0: true, 1: true},
+		QuestionAskedAt: now,
+		Flow:            "quiz",
+		State:           "asking",
+		StateEnteredAt:  now,
+	}
+
+	cases := []struct {
+		name  string
+		op    PatchOp
+		field func(s *QuizSession) interface{}
+		exp   interface{}
+	}{
+		{"questions", SetQuestions(nil), func(s *QuizSession) interface{} { return len(s.Questions) }, 0},
+		{"launch", SetLaunchID(""), func(s *QuizSession) interface{} { return s.LaunchID }, ""},
+		{"suite", SetSuiteID(""), func(s *QuizSession) interface{} { return s.SuiteID }, ""},
+		{"test", SetTestID(""), func(s *QuizSession) interface{} { return s.TestID }, ""},
+		{"suites", SetSuites(nil), func(s *QuizSession) interface{} { return len(s.Suites) }, 0},
+		{"options", SetOptions(nil), func(s *QuizSession) interface{} { return len(s.Options) }, 0},
+		{"poll", SetPoll(&Poll{ID: "poll", ChatID: 1, Options: []string{"a", "b"}, Question: 2}), func(s *QuizSession) interface{} { return *s.Poll },
+			Poll{ID: "poll", ChatID: 1, Options: []string{"a", "b"}, Question: 2}},
+		{"category suite", SetSuite("Animals", "animals"), func(s *QuizSession) interface{} { return s.Suites },
+			map[string]string{"Science": "science", "Animals": "animals"}},
+		{"false result", SetResult(1, false), func(s *QuizSession) interface{} { return s.Results },
+			map[int]bool{0: true, 1: false}},
+		{"clear results", ClearResults(), func(s *QuizSession) interface{} { return len(s.Results) }, 0},
+		{"question asked at", SetQuestionAskedAt(time.Time{}), func(s *QuizSession) interface{} { return s.QuestionAskedAt.IsZero() }, true},
+		{"flow", SetFlow(""), func(s *QuizSession) interface{} { return s.Flow }, ""},
+		{"state", SetState(""), func(s *QuizSession) interface{} { return s.State }, ""},
+		{"state entered at", SetStateEnteredAt(time.Time{}), func(s *QuizSession) interface{} { return s.StateEnteredAt.IsZero() }, true},
+	}
+
+	for _, c := range cases {
+		s := full
+		s.Suites = map[string]string{"Science": "science"}
+		s.Results = map[int]bool{0: true, 1: true}
+		if err := repo.Save(ctx, &s); nil != err {
+			t.Fatal(err)
+		}
+		if err := repo.Patch(ctx, "1", c.op); nil != err {
+			t.Fatalf("%s: %s", c.name, err)
+		}
+
+		var patched QuizSession
+		if err := repo.Load(ctx, "1", &patched); nil != err {
+			t.Fatal(err)
+		}
+		if actual := c.field(&patched); !reflect.DeepEqual(c.exp, actual) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.exp, actual)
+		}
+
+		//other fields are untouched
+		if "launch" != patched.LaunchID && "launch" != c.name {
+			t.Errorf("%s: launch ID is changed", c.name)
+		}
+		if "quiz" != patched.Flow && "flow" != c.name {
+			t.Errorf("%s: flow is changed", c.name)
+		}
+	}
+
+	if err := repo.Patch(ctx, "2", SetTestID("test")); ErrNotFound != err {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func testIDs(t *testing.T, repo SessionRepo) {
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "3"} {
+		if err := repo.Save(ctx, &QuizSession{ID: id}); nil != err {
+			t.Fatal(err)
+		}
+	}
+	repo.Delete(ctx, "2")
+
+	ids, err := repo.IDs(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+	if !reflect.DeepEqual([]string{"1", "3"}, ids) {
+		t.Errorf("Expected IDs of stored sessions, got %v", ids)
+	}
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+//MemorySessionRepo keeps sessions in memory. Sessions are lost on restart, so it's intended for tests and development
+type MemorySessionRepo struct {
+	mu sync.Mutex
+	//sessions are stored serialized so callers never share state with the repo
+	sessions map[string][]byte
+}
+
+//NewMemorySessionRepo creates new instance of MemorySessionRepo
+func NewMemorySessionRepo() *MemorySessionRepo {
+	return &MemorySessionRepo{sessions: map[string][]byte{}}
+}
+
+//Save inserts/overwrites entry. Version of the stored entry is incremented
+func (r *MemorySessionRepo) Save(ctx context.Context, s *QuizSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stored QuizSession
+	s.Version = 1
+	if err := r.load(s.ID, &stored); nil == err {
+		s.Version = stored.Version + 1
+	}
+	return r.store(s)
+}
+
+//Load loads entry by its ID
+func (r *MemorySessionRepo) Load(ctx context.Context, id string, s *QuizSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load(id, s)
+}
+
+//Delete removes entry by its ID
+func (r *MemorySessionRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, id)
+	return nil
+}
+
+//UpdateFunc applies changes to the entry using optimistic versioning
+func (r *MemorySessionRepo) UpdateFunc(ctx context.Context, id string, fn func(s *QuizSession) error) error {
+	return optimisticUpdate(func(s *QuizSession) error {
+		return r.Load(ctx, id, s)
+	}, fn, r.compareAndSave)
+}
+
+//Patch atomically applies changes of the particular fields
+func (r *MemorySessionRepo) Patch(ctx context.Context, id string, ops ...PatchOp) error {
+	return r.UpdateFunc(ctx, id, applyPatch(ops))
+}
+
+//IDs returns IDs of all the stored entries
+func (r *MemorySessionRepo) IDs(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.sessions))
+	for id := range r.sessions {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *MemorySessionRepo) compareAndSave(s *QuizSession, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stored QuizSession
+	if err := r.load(s.ID, &stored); nil != err {
+		return err
+	}
+	if stored.Version != version {
+		return ErrConflict
+	}
+	s.Version = version + 1
+	return r.store(s)
+}
+
+//Ping always succeeds since memory is always available. Keeps health checks the same for all the drivers
+func (r *MemorySessionRepo) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *MemorySessionRepo) load(id string, s *QuizSession) error {
+	b, ok := r.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(b, s)
+}
+
+func (r *MemorySessionRepo) store(s *QuizSession) error {
+	b, err := json.Marshal(s)
+	if nil != err {
+		return err
+	}
+	r.sessions[s.ID] = b
+	return nil
+}
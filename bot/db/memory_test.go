@@ -0,0 +1,9 @@
+package db
+
+import "testing"
+
+func TestMemorySessionRepo(t *testing.T) {
+	testConformance(t, func(t *testing.T) (SessionRepo, func()) {
+		return NewMemorySessionRepo(), func() {}
+	})
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"time"
+)
+
+//PatchOp changes single field of the session. Unlike partial structs, zero values are applied as well
+type PatchOp func(s *QuizSession)
+
+//applyPatch converts patch operations to the update function
+func applyPatch(ops []PatchOp) func(s *QuizSession) error {
+	return func(s *QuizSession) error {
+		for _, op := range ops {
+			op(s)
+		}
+		return nil
+	}
+}
+
+//SetQuestions sets questions of the quiz
+func SetQuestions(questions []*opentdb.Question) PatchOp {
+	return func(s *QuizSession) {
+		s.Questions = questions
+	}
+}
+
+//SetLaunchID sets ID of the RP launch
+func SetLaunchID(id string) PatchOp {
+	return func(s *QuizSession) {
+		s.LaunchID = id
+	}
+}
+
+//SetSuiteID sets ID of the RP root suite
+func SetSuiteID(id string) PatchOp {
+	return func(s *QuizSession) {
+		s.SuiteID = id
+	}
+}
+
+//SetTestID sets ID of the RP test of the current question
+func SetTestID(id string) PatchOp {
+	return func(s *QuizSession) {
+		s.TestID = id
+	}
+}
+
+//SetSuites replaces RP suites of question categories
+func SetSuites(suites map[string]string) PatchOp {
+	return func(s *QuizSession) {
+		s.Suites = suites
+	}
+}
+
+//SetSuite sets ID of the RP suite of the question category
+func SetSuite(category, id string) PatchOp {
+	return func(s *QuizSession) {
+		if nil == s.Suites {
+			s.Suites = map[string]string{}
+		}
+		s.Suites[category] = id
+	}
+}
+
+//SetResult sets result of the answer to the question with the given index
+func SetResult(q int, passed bool) PatchOp {
+	return func(s *QuizSession) {
+		if nil == s.Results {
+			s.Results = map[int]bool{}
+		}
+		s.Results[q] = passed
+	}
+}
+
+//SetUpdateID sets ID of the channel update the latest answer is recorded from
+func SetUpdateID(id int) PatchOp {
+	return func(s *QuizSession) {
+		s.UpdateID = id
+	}
+}
+
+//ClearResults removes all the answers
+func ClearResults() PatchOp {
+	return func(s *QuizSession) {
+		s.Results = map[int]bool{}
+	}
+}
+
+//SetOptions replaces answer options of the current question
+func SetOptions(options map[string]string) PatchOp {
+	return func(s *QuizSession) {
+		s.Options = options
+	}
+}
+
+//SetPoll sets native poll the current question is sent as
+func SetPoll(poll *Poll) PatchOp {
+	return func(s *QuizSession) {
+		s.Poll = poll
+	}
+}
+
+//SetQuestionAskedAt sets time current question has been asked at
+func SetQuestionAskedAt(t time.Time) PatchOp {
+	return func(s *QuizSession) {
+		s.QuestionAskedAt = t
+	}
+}
+
+//SetFlow sets dialog flow session is participating in
+func SetFlow(flow string) PatchOp {
+	return func(s *QuizSession) {
+		s.Flow = flow
+	}
+}
+
+//SetState sets state of the dialog flow
+func SetState(state string) PatchOp {
+	return func(s *QuizSession) {
+		s.State = state
+	}
+}
+
+//SetStateEnteredAt sets time current state has been entered at
+func SetStateEnteredAt(t time.Time) PatchOp {
+	return func(s *QuizSession) {
+		s.StateEnteredAt = t
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"strings"
+	"time"
+)
+
+//RedisSessionRepo keeps sessions in Redis so they can be shared by several bot replicas.
+//Sessions expire once they are not changed during TTL
+type RedisSessionRepo struct {
+	client *redis.Client
+	//TTL is a time session is kept after the last change. Zero means session never expires
+	TTL time.Duration
+	//Prefix is a prefix of the session keys
+	Prefix string
+}
+
+//NewRedisSessionRepo creates new instance of RedisSessionRepo
+func NewRedisSessionRepo(client *redis.Client, ttl time.Duration) *RedisSessionRepo {
+	return &RedisSessionRepo{client: client, TTL: ttl, Prefix: "rpquiz:session:"}
+}
+
+//Save inserts/overwrites entry. Version of the stored entry is incremented
+func (r *RedisSessionRepo) Save(ctx context.Context, s *QuizSession) error {
+	return r.write(ctx, s, -1)
+}
+
+//Load loads entry by its ID
+func (r *RedisSessionRepo) Load(ctx context.Context, id string, s *QuizSession) error {
+	return r.load(r.client.WithContext(ctx), r.key(id), s)
+}
+
+//Delete removes entry by its ID
+func (r *RedisSessionRepo) Delete(ctx context.Context, id string) error {
+	return r.client.WithContext(ctx).Del(r.key(id)).Err()
+}
+
+//UpdateFunc applies changes to the entry using optimistic versioning
+func (r *RedisSessionRepo) UpdateFunc(ctx context.Context, id string, fn func(s *QuizSession) error) error {
+	return optimisticUpdate(func(s *QuizSession) error {
+		return r.Load(ctx, id, s)
+	}, fn, func(s *QuizSession, version int) error {
+		return r.write(ctx, s, version)
+	})
+}
+
+//Patch atomically applies changes of the particular fields
+func (r *RedisSessionRepo) Patch(ctx context.Context, id string, ops ...PatchOp) error {
+	return r.UpdateFunc(ctx, id, applyPatch(ops))
+}
+
+//IDs returns IDs of all the stored entries. Keys are scanned, so Redis isn't blocked
+func (r *RedisSessionRepo) IDs(ctx context.Context) ([]string, error) {
+	var ids []string
+	iter := r.client.WithContext(ctx).Scan(0, r.Prefix+"*", 100).Iterator()
+	for iter.Next() {
+		ids = append(ids, strings.TrimPrefix(iter.Val(), r.Prefix))
+	}
+	return ids, iter.Err()
+}
+
+//Ping makes sure Redis is reachable
+func (r *RedisSessionRepo) Ping(ctx context.Context) error {
+	return r.client.WithContext(ctx).Ping().Err()
+}
+
+//write saves entry in a transaction which fails if entry is changed concurrently.
+//If version isn't negative, entry is saved only if version of the stored one is the same
+func (r *RedisSessionRepo) write(ctx context.Context, s *QuizSession, version int) error {
+	key := r.key(s.ID)
+	client := r.client.WithContext(ctx)
+	err := client.Watch(func(tx *redis.Tx) error {
+		var stored QuizSession
+		switch err := r.load(tx, key, &stored); {
+		case ErrNotFound == err && version < 0:
+			s.Version = 1
+		case nil != err:
+			return err
+		case version >= 0 && stored.Version != version:
+			return ErrConflict
+		default:
+			s.Version = stored.Version + 1
+		}
+
+		b, err := json.Marshal(s)
+		if nil != err {
+			return err
+		}
+		_, err = tx.Pipelined(func(p redis.Pipeliner) error {
+			return p.Set(key, b, r.TTL).Err()
+		})
+		return err
+	}, key)
+	if redis.TxFailedErr == err {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *RedisSessionRepo) load(c redis.Cmdable, key string, s *QuizSession) error {
+	b, err := c.Get(key).Bytes()
+	if redis.Nil == err {
+		return ErrNotFound
+	}
+	if nil != err {
+		return err
+	}
+	return json.Unmarshal(b, s)
+}
+
+func (r *RedisSessionRepo) key(id string) string {
+	return r.Prefix + id
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"testing"
+	"time"
+)
+
+func TestRedisSessionRepo(t *testing.T) {
+	testConformance(t, func(t *testing.T) (SessionRepo, func()) {
+		repo, mr := newTestRedisRepo(t)
+		return repo, mr.Close
+	})
+}
+
+func TestRedisSessionExpiry(t *testing.T) {
+	repo, mr := newTestRedisRepo(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	if err := repo.Save(ctx, &QuizSession{ID: "1"}); nil != err {
+		t.Fatal(err)
+	}
+	mr.FastForward(30 * time.Minute)
+	//each change prolongs session
+	if err := repo.Patch(ctx, "1", SetTestID("test")); nil != err {
+		t.Fatal(err)
+	}
+	mr.FastForward(30 * time.Minute)
+
+	var s QuizSession
+	if err := repo.Load(ctx, "1", &s); nil != err {
+		t.Fatalf("Expected session to be prolonged: %s", err)
+	}
+
+	mr.FastForward(time.Hour)
+	if err := repo.Load(ctx, "1", &s); ErrNotFound != err {
+		t.Errorf("Expected session to expire, got %v", err)
+	}
+}
+
+func newTestRedisRepo(t *testing.T) (*RedisSessionRepo, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if nil != err {
+		t.Fatal(err)
+	}
+	return NewRedisSessionRepo(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Hour), mr
+}
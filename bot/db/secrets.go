@@ -0,0 +1,36 @@
+package db
+
+import (
+	"crypto/rand"
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+//secretsBucket is a BoltDB bucket generated secrets are kept in
+var secretsBucket = []byte("secrets")
+
+//LoadSecret returns secret of the given name stored in BoltDB. If there is no such secret, random one of the given size
+//is generated and stored, so it survives restarts
+func LoadSecret(bdb *storm.DB, name string, size int) ([]byte, error) {
+	var secret []byte
+	err := bdb.Bolt.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(secretsBucket)
+		if nil != err {
+			return err
+		}
+		if stored := bucket.Get([]byte(name)); nil != stored {
+			//stored value is valid only within transaction
+			secret = append([]byte{}, stored...)
+			return nil
+		}
+		secret = make([]byte, size)
+		if _, err := rand.Read(secret); nil != err {
+			return err
+		}
+		return bucket.Put([]byte(name), secret)
+	})
+	if nil != err {
+		return nil, err
+	}
+	return secret, nil
+}
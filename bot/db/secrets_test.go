@@ -0,0 +1,32 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLoadSecret(t *testing.T) {
+	repo, cleanup := newTestStormRepo(t)
+	defer cleanup()
+
+	secret, err := LoadSecret(repo.db, "callback", 32)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 32 != len(secret) {
+		t.Errorf("Expected secret of 32 bytes, got %d", len(secret))
+	}
+
+	loaded, err := LoadSecret(repo.db, "callback", 32)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(secret, loaded) {
+		t.Error("Expected stored secret to be loaded")
+	}
+
+	other, _ := LoadSecret(repo.db, "other", 32)
+	if bytes.Equal(secret, other) {
+		t.Error("Expected secrets to be generated separately")
+	}
+}
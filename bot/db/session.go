@@ -2,14 +2,51 @@ package db
 
 import (
 	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"time"
 )
 
+//Poll is a channel-native poll current question is sent as
+type Poll struct {
+	ID     string
+	ChatID int64
+	//Options keep callback data of the answer options in order they are shown in the poll
+	Options []string
+	//Question is an index of the question poll is sent for
+	Question int
+}
+
 //QuizSession DB model
 type QuizSession struct {
 	ID        string `storm:"id"`
 	Questions []*opentdb.Question
-	LaunchID  string
-	SuiteID   string
-	TestID    string
-	Results   map[int]bool
-}
\ No newline at end of file
+	//Quiz is a name of the quiz questions are taken from. Empty if questions are of all the categories
+	Quiz string
+	//Event is a name of the event quiz is started at, e.g. from the deep link
+	Event string
+	//Referral is a source user came from, e.g. QR code
+	Referral string
+	LaunchID string
+	SuiteID  string
+	TestID   string
+	//Suites maps question categories to IDs of their suites in RP
+	Suites  map[string]string
+	Results map[int]bool
+	//Options maps callback tokens of the current question buttons to the answer options
+	Options map[string]string
+	//Poll is a native poll the current question is sent as, if any
+	Poll *Poll
+	//UpdateID is an ID of the channel update the latest answer is recorded from.
+	//Updates are handled again after restart, so answers of the replayed ones must be skipped
+	UpdateID int
+	//Version is incremented on each change and protects session from concurrent modification
+	Version int
+	//QuestionAskedAt is a time when current question has been asked
+	QuestionAskedAt time.Time
+
+	//Flow is a name of dialog flow session is participating in
+	Flow string
+	//State is current state of the dialog flow
+	State string
+	//StateEnteredAt is a time when current state has been entered
+	StateEnteredAt time.Time
+}
@@ -1,9 +1,55 @@
 package db
 
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+//maxUpdateAttempts limits number of attempts to apply changes to concurrently modified session
+const maxUpdateAttempts = 10
+
+var (
+	//ErrNotFound is returned when requested entry doesn't exist
+	ErrNotFound = errors.New("not found")
+	//ErrConflict is returned when entry is modified concurrently and changes cannot be applied
+	ErrConflict = errors.New("concurrent modification")
+)
+
 //SessionRepo is a general DAO/repo interface for session entity
 type SessionRepo interface {
-	Save(s *QuizSession) error
-	Load(id string, s *QuizSession) error
-	Delete(id string) error
-	Update(s *QuizSession) error
+	//Save inserts/overwrites session
+	Save(ctx context.Context, s *QuizSession) error
+	//Load loads session by its ID. Returns ErrNotFound if there is no such session
+	Load(ctx context.Context, id string, s *QuizSession) error
+	//Delete removes session by its ID. Missing session isn't an error
+	Delete(ctx context.Context, id string) error
+	//UpdateFunc loads session, applies changes and saves it unless it's been modified concurrently.
+	//Changes are re-applied to the fresh copy of the session on conflicts, so fn should have no side effects.
+	//Returns ErrNotFound if there is no such session and error returned by fn, if any
+	UpdateFunc(ctx context.Context, id string, fn func(s *QuizSession) error) error
+	//Patch atomically applies changes of the particular fields. Returns ErrNotFound if there is no such session
+	Patch(ctx context.Context, id string, ops ...PatchOp) error
+	//IDs returns IDs of all the stored sessions
+	IDs(ctx context.Context) ([]string, error)
+}
+
+//optimisticUpdate applies changes to the session and saves it if session version hasn't been changed since it's loaded.
+//Retries on ErrConflict returned by compareAndSave
+func optimisticUpdate(load func(s *QuizSession) error, fn func(s *QuizSession) error,
+	compareAndSave func(s *QuizSession, version int) error) error {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var s QuizSession
+		if err := load(&s); nil != err {
+			return err
+		}
+		version := s.Version
+		if err := fn(&s); nil != err {
+			return err
+		}
+		err := compareAndSave(&s, version)
+		if ErrConflict != err {
+			return err
+		}
+	}
+	return ErrConflict
 }
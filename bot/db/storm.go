@@ -1,10 +1,14 @@
 package db
 
 import (
+	"context"
 	"github.com/apex/log"
-	"github.com/asdine/storm"
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
 )
 
+var healthBucket = []byte("health")
+
 //StormSessionRepo represents DAO layer class for sessions DB table
 type StormSessionRepo struct {
 	db *storm.DB
@@ -23,22 +27,109 @@ func NewStormSessionRepo(db *storm.DB) (*StormSessionRepo, error) {
 
 }
 
-//Save inserts/updates entry in DB
-func (r *StormSessionRepo) Save(s *QuizSession) error {
-	return r.db.Save(s)
+//Save inserts/overwrites entry in DB. Version of the stored entry is incremented
+func (r *StormSessionRepo) Save(ctx context.Context, s *QuizSession) error {
+	tx, err := r.db.Begin(true)
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored QuizSession
+	switch err := tx.One("ID", s.ID, &stored); {
+	case nil == err:
+		s.Version = stored.Version + 1
+	case storm.ErrNotFound == err:
+		s.Version = 1
+	default:
+		return err
+	}
+	if err := tx.Save(s); nil != err {
+		return err
+	}
+	return tx.Commit()
+}
+
+//UpdateFunc applies changes to the entry using optimistic versioning
+func (r *StormSessionRepo) UpdateFunc(ctx context.Context, id string, fn func(s *QuizSession) error) error {
+	return optimisticUpdate(func(s *QuizSession) error {
+		return r.Load(ctx, id, s)
+	}, fn, r.compareAndSave)
+}
+
+//Patch atomically applies changes of the particular fields
+func (r *StormSessionRepo) Patch(ctx context.Context, id string, ops ...PatchOp) error {
+	return r.UpdateFunc(ctx, id, applyPatch(ops))
 }
 
-//Update updates only non-nil fields of entry in DB
-func (r *StormSessionRepo) Update(s *QuizSession) error {
-	return r.db.Update(s)
+//compareAndSave saves entry if version of the stored one is the same as expected
+func (r *StormSessionRepo) compareAndSave(s *QuizSession, version int) error {
+	tx, err := r.db.Begin(true)
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+
+	var stored QuizSession
+	if err := tx.One("ID", s.ID, &stored); nil != err {
+		if storm.ErrNotFound == err {
+			//removed concurrently
+			return ErrNotFound
+		}
+		return err
+	}
+	if stored.Version != version {
+		return ErrConflict
+	}
+	s.Version = version + 1
+	if err := tx.Save(s); nil != err {
+		return err
+	}
+	return tx.Commit()
 }
 
-//Delete removes entry from DB by its key/ID
-func (r *StormSessionRepo) Delete(dfID string) error {
-	return r.db.DeleteStruct(&QuizSession{ID: dfID})
+//Delete removes entry from DB by its key/ID. Missing entry isn't an error
+func (r *StormSessionRepo) Delete(ctx context.Context, dfID string) error {
+	err := r.db.DeleteStruct(&QuizSession{ID: dfID})
+	if storm.ErrNotFound == err {
+		return nil
+	}
+	return err
 }
 
 //Load loads entry from DB by its ID
-func (r *StormSessionRepo) Load(id string, s *QuizSession) error {
-	return r.db.One("ID", id, s)
+func (r *StormSessionRepo) Load(ctx context.Context, id string, s *QuizSession) error {
+	err := r.db.One("ID", id, s)
+	if storm.ErrNotFound == err {
+		return ErrNotFound
+	}
+	return err
+}
+
+//IDs returns IDs of all the stored entries
+func (r *StormSessionRepo) IDs(ctx context.Context) ([]string, error) {
+	var sessions []QuizSession
+	if err := r.db.All(&sessions); nil != err {
+		return nil, err
+	}
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	return ids, nil
+}
+
+//Ping makes sure DB is open and writable. Sentinel key is removed in the same transaction,
+//so frequent probes don't leave anything behind
+func (r *StormSessionRepo) Ping(ctx context.Context) error {
+	return r.db.Bolt.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(healthBucket)
+		if nil != err {
+			return err
+		}
+		if err := b.Put([]byte("ping"), []byte("ping")); nil != err {
+			return err
+		}
+		return b.Delete([]byte("ping"))
+	})
 }
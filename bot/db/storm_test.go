@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStormSessionRepo(t *testing.T) {
+	testConformance(t, func(t *testing.T) (SessionRepo, func()) {
+		return newTestStormRepo(t)
+	})
+}
+
+func newTestStormRepo(t *testing.T) (*StormSessionRepo, func()) {
+	dir, err := ioutil.TempDir("", "rpquiz")
+	if nil != err {
+		t.Fatal(err)
+	}
+	bdb, err := storm.Open(filepath.Join(dir, "test.db"))
+	if nil != err {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		bdb.Close()
+		os.RemoveAll(dir)
+	}
+	repo, err := NewStormSessionRepo(bdb)
+	if nil != err {
+		cleanup()
+		t.Fatal(err)
+	}
+	return repo, cleanup
+}
+
+func TestStormPing(t *testing.T) {
+	repo, cleanup := newTestStormRepo(t)
+	if err := repo.Ping(context.Background()); nil != err {
+		t.Errorf("Expected open DB to be healthy: %s", err)
+	}
+	//sentinel key isn't left behind
+	repo.db.Bolt.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(healthBucket).Get([]byte("ping")); nil != v {
+			t.Errorf("Expected sentinel key to be removed, got %s", v)
+		}
+		return nil
+	})
+
+	cleanup()
+	if err := repo.Ping(context.Background()); nil == err {
+		t.Error("Expected closed DB to be unhealthy")
+	}
+}
+
+func TestStormPingReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpquiz")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "test.db")
+	bdb, err := storm.Open(file)
+	if nil != err {
+		t.Fatal(err)
+	}
+	bdb.Close()
+
+	bdb, err = storm.Open(file, storm.BoltOptions(0600, &bolt.Options{ReadOnly: true}))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	if err := (&StormSessionRepo{db: bdb}).Ping(context.Background()); nil == err {
+		t.Error("Expected read-only DB to be unhealthy")
+	}
+}
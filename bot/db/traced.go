@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+)
+
+//TracedSessionRepo is a decorator over SessionRepo which logs each DB access
+//through request-scoped logger and reports it as a tracing span
+type TracedSessionRepo struct {
+	repo SessionRepo
+}
+
+//NewTracedSessionRepo creates new instance of TracedSessionRepo
+func NewTracedSessionRepo(repo SessionRepo) *TracedSessionRepo {
+	return &TracedSessionRepo{repo: repo}
+}
+
+//Save inserts/updates entry in DB
+func (r *TracedSessionRepo) Save(ctx context.Context, s *QuizSession) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "db.Save")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tracing.Logger(ctx).Debugf("Saving session %s", s.ID)
+	return r.repo.Save(ctx, s)
+}
+
+//Load loads entry from DB by its ID
+func (r *TracedSessionRepo) Load(ctx context.Context, id string, s *QuizSession) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "db.Load")
+	defer func() {
+		if ErrNotFound == err {
+			//missing session isn't a failure
+			tracing.EndSpan(span, nil)
+			return
+		}
+		tracing.EndSpan(span, err)
+	}()
+
+	tracing.Logger(ctx).Debugf("Loading session %s", id)
+	return r.repo.Load(ctx, id, s)
+}
+
+//Delete removes entry from DB by its key/ID
+func (r *TracedSessionRepo) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "db.Delete")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tracing.Logger(ctx).Debugf("Deleting session %s", id)
+	return r.repo.Delete(ctx, id)
+}
+
+//Patch applies changes of the particular fields in DB
+func (r *TracedSessionRepo) Patch(ctx context.Context, id string, ops ...PatchOp) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "db.Patch")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tracing.Logger(ctx).Debugf("Patching session %s", id)
+	return r.repo.Patch(ctx, id, ops...)
+}
+
+//UpdateFunc applies changes to the entry in DB
+func (r *TracedSessionRepo) UpdateFunc(ctx context.Context, id string, fn func(s *QuizSession) error) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "db.UpdateFunc")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tracing.Logger(ctx).Debugf("Updating session %s", id)
+	return r.repo.UpdateFunc(ctx, id, fn)
+}
+
+//IDs returns IDs of all the stored entries
+func (r *TracedSessionRepo) IDs(ctx context.Context) (ids []string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "db.IDs")
+	defer func() { tracing.EndSpan(span, err) }()
+
+	tracing.Logger(ctx).Debug("Listing sessions")
+	return r.repo.IDs(ctx)
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"github.com/asdine/storm/v3"
+	"github.com/go-redis/redis"
+	"strconv"
+	"sync"
+)
+
+type (
+	//UpdateLog tracks the latest handled update of the messaging channel, so polling is resumed after restart.
+	//Update IDs are expected to be increasing, e.g. Telegram update IDs.
+	//Update is committed once it and all the previous ones are handled, so each update is handled at least once
+	UpdateLog interface {
+		//Commit marks update and all the previous ones as handled. Offset never moves backwards
+		Commit(ctx context.Context, channel string, updateID int) error
+		//Offset returns ID of the latest committed update of the channel or zero if there is no such
+		Offset(ctx context.Context, channel string) (int, error)
+	}
+
+	//StormUpdateLog keeps update offsets in BoltDB
+	StormUpdateLog struct {
+		db storm.Node
+	}
+
+	//MemoryUpdateLog keeps update offsets in memory
+	MemoryUpdateLog struct {
+		mu      sync.Mutex
+		offsets map[string]int
+	}
+
+	//RedisUpdateLog keeps update offsets in Redis
+	RedisUpdateLog struct {
+		client *redis.Client
+		//Prefix is a prefix of the offset keys
+		Prefix string
+	}
+
+	//updateOffset is an offset of the channel stored in BoltDB
+	updateOffset struct {
+		Channel  string `storm:"id"`
+		UpdateID int
+	}
+)
+
+//NewStormUpdateLog creates new instance of StormUpdateLog and makes sure BoltDB bucket is created
+func NewStormUpdateLog(bdb *storm.DB) (*StormUpdateLog, error) {
+	node := bdb.From("updates")
+	if err := node.Init(&updateOffset{}); nil != err {
+		return nil, err
+	}
+	return &StormUpdateLog{db: node}, nil
+}
+
+//Commit marks update and all the previous ones as handled
+func (l *StormUpdateLog) Commit(ctx context.Context, channel string, updateID int) error {
+	tx, err := l.db.Begin(true)
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+
+	var offset updateOffset
+	if err := tx.One("Channel", channel, &offset); nil != err && storm.ErrNotFound != err {
+		return err
+	}
+	if updateID <= offset.UpdateID {
+		return nil
+	}
+	if err := tx.Save(&updateOffset{Channel: channel, UpdateID: updateID}); nil != err {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Offset returns ID of the latest committed update of the channel
+func (l *StormUpdateLog) Offset(ctx context.Context, channel string) (int, error) {
+	var offset updateOffset
+	err := l.db.One("Channel", channel, &offset)
+	if storm.ErrNotFound == err {
+		return 0, nil
+	}
+	return offset.UpdateID, err
+}
+
+//NewMemoryUpdateLog creates new instance of MemoryUpdateLog
+func NewMemoryUpdateLog() *MemoryUpdateLog {
+	return &MemoryUpdateLog{offsets: map[string]int{}}
+}
+
+//Commit marks update and all the previous ones as handled
+func (l *MemoryUpdateLog) Commit(ctx context.Context, channel string, updateID int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if updateID > l.offsets[channel] {
+		l.offsets[channel] = updateID
+	}
+	return nil
+}
+
+//Offset returns ID of the latest committed update of the channel
+func (l *MemoryUpdateLog) Offset(ctx context.Context, channel string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.offsets[channel], nil
+}
+
+//NewRedisUpdateLog creates new instance of RedisUpdateLog
+func NewRedisUpdateLog(client *redis.Client) *RedisUpdateLog {
+	return &RedisUpdateLog{client: client, Prefix: "rpquiz:offset:"}
+}
+
+//Commit marks update and all the previous ones as handled
+func (l *RedisUpdateLog) Commit(ctx context.Context, channel string, updateID int) error {
+	key := l.Prefix + channel
+	return l.client.WithContext(ctx).Watch(func(tx *redis.Tx) error {
+		offset, err := tx.Get(key).Int()
+		if nil != err && redis.Nil != err {
+			return err
+		}
+		if updateID <= offset {
+			return nil
+		}
+		_, err = tx.Pipelined(func(p redis.Pipeliner) error {
+			return p.Set(key, strconv.Itoa(updateID), 0).Err()
+		})
+		return err
+	}, key)
+}
+
+//Offset returns ID of the latest committed update of the channel
+func (l *RedisUpdateLog) Offset(ctx context.Context, channel string) (int, error) {
+	offset, err := l.client.WithContext(ctx).Get(l.Prefix + channel).Int()
+	if redis.Nil == err {
+		return 0, nil
+	}
+	return offset, err
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpdateLog(t *testing.T) {
+	repo, cleanup := newTestStormRepo(t)
+	defer cleanup()
+	stormLog, err := NewStormUpdateLog(repo.db)
+	if nil != err {
+		t.Fatal(err)
+	}
+	redisRepo, mr := newTestRedisRepo(t)
+	defer mr.Close()
+
+	logs := map[string]UpdateLog{
+		"storm":  stormLog,
+		"memory": NewMemoryUpdateLog(),
+		"redis":  NewRedisUpdateLog(redisRepo.client),
+	}
+	for name, l := range logs {
+		t.Run(name, func(t *testing.T) {
+			testUpdateLog(t, l)
+		})
+	}
+}
+
+func testUpdateLog(t *testing.T, l UpdateLog) {
+	ctx := context.Background()
+	if offset, err := l.Offset(ctx, "telegram"); nil != err || 0 != offset {
+		t.Fatalf("Expected empty offset, got %d %v", offset, err)
+	}
+
+	for _, c := range []struct {
+		id     int
+		offset int
+	}{{10, 10}, {11, 11}, {11, 11}, {5, 11}, {12, 12}} {
+		if err := l.Commit(ctx, "telegram", c.id); nil != err {
+			t.Fatal(err)
+		}
+		if offset, _ := l.Offset(ctx, "telegram"); c.offset != offset {
+			t.Errorf("Update %d: expected offset %d, got %d", c.id, c.offset, offset)
+		}
+	}
+
+	if offset, _ := l.Offset(ctx, "slack"); 0 != offset {
+		t.Errorf("Expected channels to be tracked separately, got %d", offset)
+	}
+}
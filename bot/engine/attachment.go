@@ -0,0 +1,66 @@
+package bot
+
+import (
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//AttachmentKind is a type of the file attached to the response
+type AttachmentKind string
+
+const (
+	//AttachmentImage is an image shown inline
+	AttachmentImage AttachmentKind = "image"
+	//AttachmentDocument is a file user may download
+	AttachmentDocument AttachmentKind = "document"
+)
+
+//Attachment is a platform-agnostic file attached to the response. Exactly one of URL, Path or Data is set
+type Attachment struct {
+	Kind AttachmentKind
+	//Name is a file name shown to the user
+	Name string
+	//URL is a link to the remote file
+	URL string
+	//Path is a path to the local file
+	Path string
+	//Data is a content of the embedded file
+	Data []byte
+}
+
+//NewAttachment creates attachment of the source which is either http(s) URL,
+//embedded base64 data URI (data:image/png;base64,...) or path to the local file. Local file must exist
+func NewAttachment(kind AttachmentKind, source string) (*Attachment, error) {
+	switch {
+	case "" == source:
+		return nil, errors.New("attachment source is empty")
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		return &Attachment{Kind: kind, Name: filepath.Base(source), URL: source}, nil
+	case strings.HasPrefix(source, "data:"):
+		i := strings.Index(source, ";base64,")
+		if i < 0 {
+			return nil, errors.New("only base64 data URIs are supported")
+		}
+		data, err := base64.StdEncoding.DecodeString(source[i+len(";base64,"):])
+		if nil != err {
+			return nil, errors.Wrap(err, "incorrect data URI")
+		}
+		return &Attachment{Kind: kind, Name: string(kind) + extension(source[len("data:"):i]), Data: data}, nil
+	default:
+		if _, err := os.Stat(source); nil != err {
+			return nil, errors.Wrap(err, "attachment file isn't available")
+		}
+		return &Attachment{Kind: kind, Name: filepath.Base(source), Path: source}, nil
+	}
+}
+
+//extension guesses file extension of the MIME type, e.g. image/png
+func extension(mimeType string) string {
+	if i := strings.LastIndex(mimeType, "/"); i >= 0 && i < len(mimeType)-1 {
+		return "." + strings.SplitN(mimeType[i+1:], "+", 2)[0]
+	}
+	return ""
+}
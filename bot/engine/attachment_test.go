@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewAttachment(t *testing.T) {
+	f, err := ioutil.TempFile("", "widget")
+	if nil != err {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	for _, c := range []struct {
+		source string
+		exp    Attachment
+	}{
+		{"https://rp.io/widget.png", Attachment{Kind: AttachmentImage, Name: "widget.png", URL: "https://rp.io/widget.png"}},
+		{f.Name(), Attachment{Kind: AttachmentImage, Name: filepath.Base(f.Name()), Path: f.Name()}},
+		{"data:image/png;base64,cnBxdWl6", Attachment{Kind: AttachmentImage, Name: "image.png", Data: []byte("rpquiz")}},
+		{"data:image/svg+xml;base64,cnBxdWl6", Attachment{Kind: AttachmentImage, Name: "image.svg", Data: []byte("rpquiz")}},
+	} {
+		a, err := NewAttachment(AttachmentImage, c.source)
+		if nil != err {
+			t.Errorf("%s: %s", c.source, err)
+			continue
+		}
+		if c.exp.Name != a.Name || c.exp.URL != a.URL || c.exp.Path != a.Path || string(c.exp.Data) != string(a.Data) {
+			t.Errorf("%s: expected %+v, got %+v", c.source, c.exp, a)
+		}
+	}
+
+	for _, source := range []string{"", "data:image/png,rpquiz", "data:image/png;base64,???", "/missing/widget.png"} {
+		if _, err := NewAttachment(AttachmentDocument, source); nil == err {
+			t.Errorf("%s: expected error", source)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+//signatureLength is a length of the encoded signature. 12 characters keep 72 bits of HMAC
+const signatureLength = 12
+
+//CallbackSigner signs callback data of the buttons, so users can't forge callbacks.
+//Signed data is "<token>.<signature>" which fits into Telegram's 64-byte limit for short tokens
+type CallbackSigner struct {
+	key []byte
+}
+
+//NewCallbackSigner creates new instance of CallbackSigner. If key is empty, random one is generated,
+//so callbacks signed before restart become invalid
+func NewCallbackSigner(key []byte) (*CallbackSigner, error) {
+	if 0 == len(key) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); nil != err {
+			return nil, err
+		}
+	}
+	return &CallbackSigner{key: key}, nil
+}
+
+//Sign signs token in scope of the user, so token can't be replayed by other users
+func (s *CallbackSigner) Sign(scope, token string) string {
+	return token + "." + s.signature(scope, token)
+}
+
+//Verify checks signature of the callback data and returns signed token
+func (s *CallbackSigner) Verify(scope, data string) (string, bool) {
+	i := strings.LastIndex(data, ".")
+	if i < 0 {
+		return "", false
+	}
+	token, sig := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.signature(scope, token))) {
+		return "", false
+	}
+	return token, true
+}
+
+func (s *CallbackSigner) signature(scope, token string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(scope))
+	mac.Write([]byte{0})
+	mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:signatureLength]
+}
+
+//NewToken generates short random token
+func NewToken() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); nil != err {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
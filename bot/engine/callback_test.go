@@ -0,0 +1,40 @@
+package bot
+
+import "testing"
+
+func TestCallbackSigner(t *testing.T) {
+	s, err := NewCallbackSigner([]byte("secret"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	token, err := NewToken()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	data := s.Sign("user-1", token)
+	if len(data) > 64 {
+		t.Errorf("Callback data exceeds 64 bytes: %s", data)
+	}
+	if verified, ok := s.Verify("user-1", data); !ok || token != verified {
+		t.Errorf("Expected token %s to be verified, got %s %v", token, verified, ok)
+	}
+
+	other, _ := NewCallbackSigner([]byte("other"))
+	for name, c := range map[string]struct {
+		signer *CallbackSigner
+		scope  string
+		data   string
+	}{
+		"other user":   {s, "user-2", data},
+		"forged token": {s, "user-1", "forged" + data[len(token):]},
+		"no signature": {s, "user-1", token},
+		"other key":    {other, "user-1", data},
+		"raw answer":   {s, "user-1", "Report Portal"},
+		"empty":        {s, "user-1", ""},
+	} {
+		if _, ok := c.signer.Verify(c.scope, c.data); ok {
+			t.Errorf("%s: expected callback to be rejected", name)
+		}
+	}
+}
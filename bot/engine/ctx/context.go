@@ -12,6 +12,9 @@ const (
 	userIDKey       contextKey = "userIDKey"
 	originalMessage contextKey = "originalMessage"
 	session         contextKey = "session"
+	channelKey      contextKey = "channel"
+	eventKey        contextKey = "event"
+	updateIDKey     contextKey = "updateID"
 )
 
 //WithUserName adds a user name to the context
@@ -52,6 +55,48 @@ func GetOriginalMessage(ctx context.Context) interface{} {
 	return ctx.Value(originalMessage)
 }
 
+//WithChannel adds name of the messaging channel request came from to the context
+func WithChannel(ctx context.Context, ch string) context.Context {
+	return context.WithValue(ctx, channelKey, ch)
+}
+
+//GetChannel takes name of the messaging channel from the context
+func GetChannel(ctx context.Context) string {
+	ch, ok := ctx.Value(channelKey).(string)
+	if !ok {
+		return ""
+	}
+	return ch
+}
+
+//WithEvent adds name of the event (e.g. conference) user participates in to the context
+func WithEvent(ctx context.Context, e string) context.Context {
+	return context.WithValue(ctx, eventKey, e)
+}
+
+//GetEvent takes name of the event from the context
+func GetEvent(ctx context.Context) string {
+	e, ok := ctx.Value(eventKey).(string)
+	if !ok {
+		return ""
+	}
+	return e
+}
+
+//WithUpdateID adds ID of the channel update request is made of to the context
+func WithUpdateID(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, updateIDKey, id)
+}
+
+//GetUpdateID takes ID of the channel update from the context. Zero if channel has no update IDs
+func GetUpdateID(ctx context.Context) int {
+	id, ok := ctx.Value(updateIDKey).(int)
+	if !ok {
+		return 0
+	}
+	return id
+}
+
 //WithSession adds original message to the context
 func WithSession(ctx context.Context, s *db.QuizSession) context.Context {
 	return context.WithValue(ctx, session, s)
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"strings"
+)
+
+//Parameters of the deep link
+const (
+	//DeepLinkQuiz is a name of the quiz to start
+	DeepLinkQuiz = "quiz"
+	//DeepLinkEvent is a name of the event (e.g. conference) user participates in
+	DeepLinkEvent = "event"
+	//DeepLinkRef is a referral source, e.g. QR code on the booth
+	DeepLinkRef = "ref"
+)
+
+//ParseDeepLink parses start parameter of the deep link, e.g. t.me/bot?start=event-JSConf_quiz-widgets_ref-booth.
+//Parameter is a list of key-value pairs separated by "_", key is separated from value by the first "-".
+//Segment without a key is an event name, so t.me/bot?start=JSConf starts quiz of the event
+func ParseDeepLink(payload string) map[string]string {
+	params := map[string]string{}
+	for _, segment := range strings.Split(payload, "_") {
+		if "" == segment {
+			continue
+		}
+		kv := strings.SplitN(segment, "-", 2)
+		if 1 == len(kv) {
+			params[DeepLinkEvent] = kv[0]
+			continue
+		}
+		if "" != kv[0] && "" != kv[1] {
+			params[strings.ToLower(kv[0])] = kv[1]
+		}
+	}
+	return params
+}
+
+//DispatchStart dispatches request to start conversation, e.g. deep link, as StartIntent bypassing NLP.
+//If StartIntent isn't configured, request is dispatched as regular message
+func (d *Dispatcher) DispatchStart(ctx context.Context, raw string, params map[string]string) []*Response {
+	if "" == d.StartIntent {
+		return d.Dispatch(ctx, raw, false)
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "dispatch")
+	defer span.End()
+	ctx = tracing.WithFields(tracing.NewRequest(ctx), log.Fields{"user_id": botctx.GetUserID(ctx)})
+
+	return d.DispatchRQ(ctx, &IntentRequest{
+		Intent:     d.StartIntent,
+		Raw:        raw,
+		Params:     params,
+		Confidence: 1,
+	})
+}
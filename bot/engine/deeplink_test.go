@@ -0,0 +1,22 @@
+package bot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDeepLink(t *testing.T) {
+	for _, c := range []struct {
+		payload string
+		exp     map[string]string
+	}{
+		{"", map[string]string{}},
+		{"JSConf", map[string]string{"event": "JSConf"}},
+		{"event-JSConf_quiz-widgets_ref-booth", map[string]string{"event": "JSConf", "quiz": "widgets", "ref": "booth"}},
+		{"Ref-qr-code-1__quiz-", map[string]string{"ref": "qr-code-1"}},
+	} {
+		if params := ParseDeepLink(c.payload); !reflect.DeepEqual(c.exp, params) {
+			t.Errorf("%s: expected %v, got %v", c.payload, c.exp, params)
+		}
+	}
+}
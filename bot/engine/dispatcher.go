@@ -3,9 +3,12 @@ package bot
 import (
 	"context"
 	"github.com/apex/log"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
 	"github.com/avarabyeu/rpquiz/bot/nlp"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
 	"github.com/pkg/errors"
 	"sync"
+	"time"
 )
 
 type (
@@ -27,11 +30,20 @@ type (
 
 		middlewares []Middleware
 		initSync    sync.Once
+		//locks serialize handling of requests of the same user
+		locks userLocks
 
 		//Intents    map[string]Handler
 		Handler    Handler
 		ErrHandler ErrorHandler
-		NLP        *nlp.IntentParser
+		NLP        IntentParser
+		//StartIntent is an intent requests to start conversation are dispatched as
+		StartIntent string
+	}
+
+	//IntentParser recognizes user intent in natural language
+	IntentParser interface {
+		Parse(ctx context.Context, q string) (*nlp.Intent, error)
 	}
 
 	//Request is a general abstraction over user requests
@@ -54,14 +66,30 @@ type (
 
 	//Response is platform-agnostic answer representation
 	Response struct {
-		Text    string
+		Text    RichText
 		Buttons []*Button
+		//Columns is a number of buttons per row. Zero means a button per row
+		Columns int
+		//Keyboard defines how buttons are shown
+		Keyboard KeyboardKind
+		//RemoveKeyboard hides reply keyboard shown by previous responses. Ignored if response has buttons
+		RemoveKeyboard bool
+		//Attachments are files sent along with the text
+		Attachments []*Attachment
+		//Poll is set if response is a question channel may render as native quiz poll
+		Poll *Poll
+		//Delay is a pause before the response is sent, so multi-message replies feel conversational
+		Delay time.Duration
+		//Typing shows typing indicator during the delay
+		Typing bool
 	}
 
 	//Button is platform-agnostic button representation
 	Button struct {
 		Text string
 		Data string
+		//URL makes button a link. Supported by inline keyboards only
+		URL string
 	}
 
 	// The HandlerFunc type is an adapter to allow the use of
@@ -90,10 +118,16 @@ func NewHandlerFunc(f func(ctx context.Context, rq Request) ([]*Response, error)
 	return f
 }
 
-//DispatchRQ dispatches parsed user question to appropriate handler
+//DispatchRQ dispatches parsed user question to appropriate handler.
+//Requests of the same user are handled one by one
 func (d *Dispatcher) DispatchRQ(ctx context.Context, rq Request) (rs []*Response) {
 	d.init()
 
+	if userID := botctx.GetUserID(ctx); "" != userID {
+		unlock := d.locks.lock(userID)
+		defer unlock()
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			rs = d.ErrHandler.Handle(ctx, errors.Errorf("%s", r))
@@ -101,7 +135,7 @@ func (d *Dispatcher) DispatchRQ(ctx context.Context, rq Request) (rs []*Response
 		}
 	}()
 
-	log.Debugf("Handling user request: %s", rq)
+	tracing.Logger(ctx).Debugf("Handling user request: %s", rq.GetRaw())
 	var err error
 	rs, err = d.Handler.Handle(ctx, rq)
 	if nil != err {
@@ -122,11 +156,20 @@ func (d *Dispatcher) Use(m func(Handler) Handler) *Dispatcher {
 
 //Dispatch parses user question and then dispatches to appropriate handler
 func (d *Dispatcher) Dispatch(ctx context.Context, msg string, callback bool) (rs []*Response) {
+	ctx, span := tracing.StartSpan(ctx, "dispatch")
+	defer span.End()
+	ctx = tracing.WithFields(tracing.NewRequest(ctx), log.Fields{"user_id": botctx.GetUserID(ctx)})
+
 	if callback {
 		return d.DispatchRQ(ctx, &CallbackRequest{Raw: msg})
 	}
 
-	intent := d.NLP.Parse(msg)
+	intent, err := d.NLP.Parse(ctx, msg)
+	if nil != err {
+		//intent cannot be recognized. Let fallback handle it
+		tracing.Logger(ctx).WithError(err).Error("Cannot parse intent")
+		intent = &nlp.Intent{}
+	}
 
 	rq := &IntentRequest{
 		Intent:     intent.Name,
@@ -183,7 +226,32 @@ func NewResponse() *Response {
 
 //WithText adds simple text to the response and returns itself
 func (rs *Response) WithText(t string) *Response {
-	rs.Text = t
+	rs.Text = NewText(Plain(t))
+	return rs
+}
+
+//WithRichText adds formatted text to the response and returns itself
+func (rs *Response) WithRichText(spans ...*Span) *Response {
+	rs.Text = NewText(spans...)
+	return rs
+}
+
+//WithDelay pauses before the response is sent
+func (rs *Response) WithDelay(d time.Duration) *Response {
+	rs.Delay = d
+	return rs
+}
+
+//WithTyping shows typing indicator for the given duration before the response is sent
+func (rs *Response) WithTyping(d time.Duration) *Response {
+	rs.Delay = d
+	rs.Typing = true
+	return rs
+}
+
+//WithAttachments attaches files to the response
+func (rs *Response) WithAttachments(attachments ...*Attachment) *Response {
+	rs.Attachments = append(rs.Attachments, attachments...)
 	return rs
 }
 
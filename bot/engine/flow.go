@@ -0,0 +1,289 @@
+package bot
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"github.com/pkg/errors"
+	"time"
+)
+
+const (
+	//EventIntent is triggered by recognized user intent
+	EventIntent EventType = "intent"
+	//EventCallback is triggered by callback/answer to some question
+	EventCallback EventType = "callback"
+	//EventTimeout is triggered when user stays in some state longer than state's timeout
+	EventTimeout EventType = "timeout"
+)
+
+type (
+	//EventType is a type of event that may trigger dialog state transition
+	EventType string
+
+	//State is a named state of a dialog flow
+	State string
+
+	//Transition describes how dialog flow moves from one state to another
+	Transition struct {
+		//On is a type of the event triggering transition. Empty means any event satisfying the guard
+		On EventType
+		//Intent is a name of intent triggering transition. Matters for intent events only. Empty means any intent
+		Intent string
+		//Guard is an optional additional condition transition should satisfy. Mandatory if event type is empty
+		Guard Predicate
+		//To is a target state. Empty means internal transition (state isn't changed, hooks aren't executed)
+		To State
+		//Action is executed when transition fires
+		Action Handler
+	}
+
+	//StateConfig describes state of dialog flow
+	StateConfig struct {
+		//Handler handles requests which do not trigger any transition. Fallback is used if empty
+		Handler Handler
+		//OnEnter is executed once state is entered
+		OnEnter Handler
+		//OnExit is executed once state is left
+		OnExit Handler
+		//Timeout after which timeout transitions are triggered. Zero means no timeout
+		Timeout time.Duration
+		//Transitions in order of precedence
+		Transitions []*Transition
+	}
+
+	//Flow is a dialog state machine. Flow state is persisted in user's session
+	Flow struct {
+		Name    string
+		Initial State
+		States  map[State]*StateConfig
+	}
+
+	//TimeoutRequest is a request triggered by state timeout
+	TimeoutRequest struct {
+		//State which has been timed out
+		State State
+	}
+
+	//FlowDispatcher is a composite Handler dispatching requests over dialog flows.
+	//Requests of users not participating in any flow start the first flow which has a matching
+	//transition from its initial state
+	FlowDispatcher struct {
+		repo     db.SessionRepo
+		flows    []*Flow
+		fallback Handler
+	}
+)
+
+//NewFlowDispatcher creates new instance of FlowDispatcher
+func NewFlowDispatcher(repo db.SessionRepo, fallback Handler, flows ...*Flow) *FlowDispatcher {
+	return &FlowDispatcher{
+		repo:     repo,
+		flows:    flows,
+		fallback: fallback,
+	}
+}
+
+//Handle dispatches request to the flow user is participating in
+func (d *FlowDispatcher) Handle(ctx context.Context, rq Request) ([]*Response, error) {
+	var rss []*Response
+
+	flow, state := d.current(ctx)
+	if nil != flow && d.expired(ctx, flow, state) {
+		var err error
+		if rss, state, err = d.fire(ctx, flow, state, &TimeoutRequest{State: state}); nil != err {
+			return nil, err
+		}
+		if state == flow.Initial {
+			//flow is over. Request may start another one
+			flow = nil
+		}
+	}
+
+	if nil == flow {
+		for _, f := range d.flows {
+			if t := f.match(ctx, f.Initial, rq); nil != t {
+				trss, _, err := d.transit(ctx, f, f.Initial, t, rq)
+				return append(rss, trss...), err
+			}
+		}
+		trss, err := d.fallback.Handle(ctx, rq)
+		return append(rss, trss...), err
+	}
+
+	trss, _, err := d.fire(ctx, flow, state, rq)
+	return append(rss, trss...), err
+}
+
+//Expire fires timeout transitions of the session's state if state's timeout has elapsed.
+//Returns whether flow state has been changed
+func (d *FlowDispatcher) Expire(ctx context.Context, session *db.QuizSession) ([]*Response, bool, error) {
+	flow := d.flow(session.Flow)
+	if nil == flow {
+		return nil, false, nil
+	}
+	state := State(session.State)
+	if !d.expired(botctx.WithSession(ctx, session), flow, state) {
+		return nil, false, nil
+	}
+	rss, newState, err := d.fire(botctx.WithSession(ctx, session), flow, state, &TimeoutRequest{State: state})
+	return rss, newState != state, err
+}
+
+//fire finds transition matching the request and executes it.
+//If there is no such transition, request is handled by state's handler
+func (d *FlowDispatcher) fire(ctx context.Context, flow *Flow, state State, rq Request) ([]*Response, State, error) {
+	if t := flow.match(ctx, state, rq); nil != t {
+		return d.transit(ctx, flow, state, t, rq)
+	}
+	if _, ok := rq.(*TimeoutRequest); ok {
+		//timeout isn't handled by the flow
+		return nil, state, nil
+	}
+
+	handler := d.fallback
+	if cfg, ok := flow.States[state]; ok && nil != cfg.Handler {
+		handler = cfg.Handler
+	}
+	rss, err := handler.Handle(ctx, rq)
+	return rss, state, err
+}
+
+//transit executes transition: exit hook, transition's action, state persistence and enter hook
+func (d *FlowDispatcher) transit(ctx context.Context, flow *Flow, from State, t *Transition, rq Request) ([]*Response, State, error) {
+	var rss []*Response
+	external := "" != t.To
+
+	tracing.Logger(ctx).Debugf("Flow %s: %s -> %s", flow.Name, from, t.To)
+
+	if cfg, ok := flow.States[from]; external && ok && nil != cfg.OnExit {
+		exitRss, err := cfg.OnExit.Handle(ctx, rq)
+		if nil != err {
+			return nil, from, err
+		}
+		rss = append(rss, exitRss...)
+	}
+
+	if nil != t.Action {
+		actionRss, err := t.Action.Handle(ctx, rq)
+		if nil != err {
+			return nil, from, err
+		}
+		rss = append(rss, actionRss...)
+	}
+
+	if !external {
+		return rss, from, nil
+	}
+
+	if err := d.saveState(ctx, flow, t.To); nil != err {
+		return nil, from, err
+	}
+
+	if cfg, ok := flow.States[t.To]; ok && nil != cfg.OnEnter {
+		enterRss, err := cfg.OnEnter.Handle(ctx, rq)
+		if nil != err {
+			return nil, t.To, err
+		}
+		rss = append(rss, enterRss...)
+	}
+	return rss, t.To, nil
+}
+
+//saveState persists flow state into user's session.
+//Transition's action may create or delete session, that's why it's reloaded from the DB
+func (d *FlowDispatcher) saveState(ctx context.Context, flow *Flow, state State) error {
+	userID := botctx.GetUserID(ctx)
+	if "" == userID {
+		return errors.New("User ID isn't recognized")
+	}
+
+	flowName := flow.Name
+	if state == flow.Initial {
+		//flow is over
+		flowName = ""
+		state = ""
+	}
+	now := time.Now()
+
+	err := d.repo.Patch(ctx, userID, db.SetFlow(flowName), db.SetState(string(state)), db.SetStateEnteredAt(now))
+	switch {
+	case db.ErrNotFound == err && "" == flowName:
+		//flow is over and session is already removed
+		return nil
+	case db.ErrNotFound == err:
+		return d.repo.Save(ctx, &db.QuizSession{ID: userID, Flow: flowName, State: string(state), StateEnteredAt: now})
+	}
+	return err
+}
+
+//current finds flow and state user is participating in
+func (d *FlowDispatcher) current(ctx context.Context) (*Flow, State) {
+	session, ok := botctx.GetSession(ctx)
+	if !ok {
+		return nil, ""
+	}
+	flow := d.flow(session.Flow)
+	if nil == flow {
+		return nil, ""
+	}
+	return flow, State(session.State)
+}
+
+func (d *FlowDispatcher) flow(name string) *Flow {
+	if "" == name {
+		return nil
+	}
+	for _, f := range d.flows {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (d *FlowDispatcher) expired(ctx context.Context, flow *Flow, state State) bool {
+	session, ok := botctx.GetSession(ctx)
+	if !ok {
+		return false
+	}
+	cfg, ok := flow.States[state]
+	return ok && cfg.Timeout > 0 && time.Since(session.StateEnteredAt) > cfg.Timeout
+}
+
+//match finds first transition from the given state matching the request
+func (f *Flow) match(ctx context.Context, state State, rq Request) *Transition {
+	cfg, ok := f.States[state]
+	if !ok {
+		return nil
+	}
+	for _, t := range cfg.Transitions {
+		if t.matches(ctx, rq) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (t *Transition) matches(ctx context.Context, rq Request) bool {
+	if "" == t.On {
+		return nil != t.Guard && t.Guard(ctx, rq)
+	}
+
+	var ok bool
+	switch r := rq.(type) {
+	case *IntentRequest:
+		ok = EventIntent == t.On && r.Confidence >= acceptableConfidence && ("" == t.Intent || t.Intent == r.Intent)
+	case *CallbackRequest:
+		ok = EventCallback == t.On
+	case *TimeoutRequest:
+		ok = EventTimeout == t.On
+	}
+	return ok && (nil == t.Guard || t.Guard(ctx, rq))
+}
+
+//GetRaw takes raw user message. Timeouts have no message
+func (rq *TimeoutRequest) GetRaw() string {
+	return ""
+}
@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testUser = "user"
+
+func TestFlowTransitions(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	d := NewFlowDispatcher(repo, respondWith("fallback"), newTestFlow(nil))
+
+	cases := []struct {
+		name  string
+		rq    Request
+		exp   []string
+		state string
+	}{
+		{"no flow", &IntentRequest{Intent: "hello", Confidence: 0.9}, []string{"fallback"}, ""},
+		{"start", &IntentRequest{Intent: "start", Confidence: 0.9}, []string{"started", "entered"}, "asking"},
+		{"unhandled", &IntentRequest{Intent: "hello", Confidence: 0.9}, []string{"unhandled"}, "asking"},
+		{"internal", &CallbackRequest{Raw: "1"}, []string{"answered"}, "asking"},
+		{"precedence", &CallbackRequest{Raw: "last"}, []string{"exited", "last"}, ""},
+	}
+	for _, c := range cases {
+		rss, err := dispatchFlow(d, repo, c.rq)
+		if nil != err {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+		if !reflect.DeepEqual(c.exp, textsOf(rss)) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.exp, textsOf(rss))
+		}
+		var session db.QuizSession
+		if err := repo.Load(context.Background(), testUser, &session); nil == err && c.state != session.State {
+			t.Errorf("%s: expected state '%s', got '%s'", c.name, c.state, session.State)
+		}
+	}
+}
+
+func TestFlowInternalTransitionKeepsState(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	d := NewFlowDispatcher(repo, respondWith("fallback"), newTestFlow(nil))
+
+	if _, err := dispatchFlow(d, repo, &IntentRequest{Intent: "start", Confidence: 0.9}); nil != err {
+		t.Fatal(err)
+	}
+	var entered db.QuizSession
+	repo.Load(context.Background(), testUser, &entered)
+
+	if _, err := dispatchFlow(d, repo, &CallbackRequest{Raw: "1"}); nil != err {
+		t.Fatal(err)
+	}
+	var session db.QuizSession
+	repo.Load(context.Background(), testUser, &session)
+	if !session.StateEnteredAt.Equal(entered.StateEnteredAt) {
+		t.Error("Internal transition shouldn't re-enter the state")
+	}
+}
+
+func TestFlowCompletedBySessionRemoval(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	//action of the final transition removes the session
+	remove := NewHandlerFunc(func(ctx context.Context, rq Request) ([]*Response, error) {
+		return Respond(NewResponse().WithText("removed")), repo.Delete(ctx, testUser)
+	})
+	d := NewFlowDispatcher(repo, respondWith("fallback"), newTestFlow(remove))
+
+	if _, err := dispatchFlow(d, repo, &IntentRequest{Intent: "start", Confidence: 0.9}); nil != err {
+		t.Fatal(err)
+	}
+	rss, err := dispatchFlow(d, repo, &IntentRequest{Intent: "stop", Confidence: 0.9})
+	if nil != err {
+		t.Fatalf("Flow completion shouldn't fail if session is removed: %s", err)
+	}
+	if exp := []string{"exited", "removed"}; !reflect.DeepEqual(exp, textsOf(rss)) {
+		t.Errorf("Expected %v, got %v", exp, textsOf(rss))
+	}
+	if err := repo.Load(context.Background(), testUser, &db.QuizSession{}); db.ErrNotFound != err {
+		t.Errorf("Expected session to stay removed, got %v", err)
+	}
+}
+
+func TestFlowTimeout(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	d := NewFlowDispatcher(repo, respondWith("fallback"), newTestFlow(nil))
+
+	if _, err := dispatchFlow(d, repo, &IntentRequest{Intent: "start", Confidence: 0.9}); nil != err {
+		t.Fatal(err)
+	}
+	expire(t, repo)
+
+	//timeout is fired first, then request may start the flow again
+	rss, err := dispatchFlow(d, repo, &IntentRequest{Intent: "start", Confidence: 0.9})
+	if nil != err {
+		t.Fatal(err)
+	}
+	if exp := []string{"exited", "timed out", "started", "entered"}; !reflect.DeepEqual(exp, textsOf(rss)) {
+		t.Errorf("Expected %v, got %v", exp, textsOf(rss))
+	}
+
+	//session isn't expired yet
+	var session db.QuizSession
+	repo.Load(context.Background(), testUser, &session)
+	if _, changed, _ := d.Expire(botctx.WithUserID(context.Background(), testUser), &session); changed {
+		t.Error("Session isn't expected to be expired")
+	}
+
+	expire(t, repo)
+	repo.Load(context.Background(), testUser, &session)
+	rss, changed, err := d.Expire(botctx.WithUserID(context.Background(), testUser), &session)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("Expected session to be expired")
+	}
+	if exp := []string{"exited", "timed out"}; !reflect.DeepEqual(exp, textsOf(rss)) {
+		t.Errorf("Expected %v, got %v", exp, textsOf(rss))
+	}
+}
+
+//newTestFlow creates flow: start intent enters asking state, callbacks are answers,
+//'last' callback and stop intent complete the flow. Stop action may be overridden
+func newTestFlow(stop Handler) *Flow {
+	if nil == stop {
+		stop = respondWith("stopped")
+	}
+	isLast := func(ctx context.Context, rq Request) bool {
+		return "last" == rq.GetRaw()
+	}
+	return &Flow{
+		Name:    "test",
+		Initial: "idle",
+		States: map[State]*StateConfig{
+			"idle": {
+				Transitions: []*Transition{
+					{On: EventIntent, Intent: "start", To: "asking", Action: respondWith("started")},
+				},
+			},
+			"asking": {
+				Handler: respondWith("unhandled"),
+				OnEnter: respondWith("entered"),
+				OnExit:  respondWith("exited"),
+				Timeout: time.Minute,
+				Transitions: []*Transition{
+					{On: EventIntent, Intent: "stop", To: "idle", Action: stop},
+					{On: EventCallback, Guard: isLast, To: "idle", Action: respondWith("last")},
+					{On: EventCallback, Action: respondWith("answered")},
+					{On: EventTimeout, To: "idle", Action: respondWith("timed out")},
+				},
+			},
+		},
+	}
+}
+
+//dispatchFlow handles request of the test user loading its session the same way dispatcher middleware does
+func dispatchFlow(d *FlowDispatcher, repo db.SessionRepo, rq Request) ([]*Response, error) {
+	ctx := botctx.WithUserID(context.Background(), testUser)
+	var session db.QuizSession
+	if err := repo.Load(ctx, testUser, &session); nil == err {
+		ctx = botctx.WithSession(ctx, &session)
+	}
+	return d.Handle(ctx, rq)
+}
+
+//expire moves time the state has been entered at to the past
+func expire(t *testing.T, repo db.SessionRepo) {
+	if err := repo.Patch(context.Background(), testUser, db.SetStateEnteredAt(time.Now().Add(-time.Hour))); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func textsOf(rss []*Response) []string {
+	texts := make([]string, len(rss))
+	for i, rs := range rss {
+		texts[i] = rs.Text.String()
+	}
+	return texts
+}
@@ -0,0 +1,51 @@
+package bot
+
+//KeyboardKind defines how response buttons are shown to the user
+type KeyboardKind int
+
+const (
+	//KeyboardInline shows buttons attached to the message. Pressed button sends its data as a callback
+	KeyboardInline KeyboardKind = iota
+	//KeyboardReply shows quick replies instead of the keyboard. Pressed button sends its text as a message
+	KeyboardReply
+)
+
+//NewURLButton creates button which opens the URL
+func NewURLButton(text, url string) *Button {
+	return &Button{Text: text, URL: url}
+}
+
+//WithColumns sets number of buttons per row
+func (rs *Response) WithColumns(columns int) *Response {
+	rs.Columns = columns
+	return rs
+}
+
+//WithReplyKeyboard shows buttons as quick replies
+func (rs *Response) WithReplyKeyboard() *Response {
+	rs.Keyboard = KeyboardReply
+	return rs
+}
+
+//WithoutKeyboard hides reply keyboard shown by previous responses
+func (rs *Response) WithoutKeyboard() *Response {
+	rs.RemoveKeyboard = true
+	return rs
+}
+
+//Rows splits buttons into rows according to the number of columns
+func (rs *Response) Rows() [][]*Button {
+	columns := rs.Columns
+	if columns < 1 {
+		columns = 1
+	}
+	rows := make([][]*Button, 0, (len(rs.Buttons)+columns-1)/columns)
+	for i := 0; i < len(rs.Buttons); i += columns {
+		end := i + columns
+		if end > len(rs.Buttons) {
+			end = len(rs.Buttons)
+		}
+		rows = append(rows, rs.Buttons[i:end])
+	}
+	return rows
+}
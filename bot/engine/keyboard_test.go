@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestResponseRows(t *testing.T) {
+	btns := []*Button{{Text: "1"}, {Text: "2"}, {Text: "3"}, {Text: "4"}, {Text: "5"}}
+	for _, c := range []struct {
+		columns int
+		exp     []int
+	}{
+		{0, []int{1, 1, 1, 1, 1}},
+		{1, []int{1, 1, 1, 1, 1}},
+		{2, []int{2, 2, 1}},
+		{5, []int{5}},
+		{10, []int{5}},
+	} {
+		rows := NewResponse().WithButtons(btns...).WithColumns(c.columns).Rows()
+		if len(c.exp) != len(rows) {
+			t.Errorf("%d columns: expected %d rows, got %d", c.columns, len(c.exp), len(rows))
+			continue
+		}
+		next := 1
+		for i, row := range rows {
+			if c.exp[i] != len(row) {
+				t.Errorf("%d columns: expected %d buttons in row %d, got %d", c.columns, c.exp[i], i, len(row))
+			}
+			for _, btn := range row {
+				if strconv.Itoa(next) != btn.Text {
+					t.Errorf("%d columns: buttons order is broken", c.columns)
+				}
+				next++
+			}
+		}
+	}
+
+	if rows := NewResponse().Rows(); 0 != len(rows) {
+		t.Errorf("Expected no rows, got %d", len(rows))
+	}
+}
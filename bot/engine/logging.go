@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"time"
+)
+
+//RequestLogging is a middleware which adds intent and session details to the request-scoped logger
+//and logs outcome of request handling. Should be added after the session has been loaded
+func RequestLogging(next Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, rq Request) ([]*Response, error) {
+		fields := log.Fields{}
+		switch r := rq.(type) {
+		case *IntentRequest:
+			fields["intent"] = r.Intent
+			fields["confidence"] = r.Confidence
+		case *CallbackRequest:
+			fields["callback"] = true
+		}
+		if session, ok := botctx.GetSession(ctx); ok {
+			fields["session_id"] = session.ID
+			fields["state"] = session.State
+		}
+		ctx = tracing.WithFields(ctx, fields)
+
+		start := time.Now()
+		rss, err := next.Handle(ctx, rq)
+
+		logger := tracing.Logger(ctx).WithField("duration", time.Since(start).String())
+		if nil != err {
+			logger.WithError(err).Warn("Request handling failed")
+		} else {
+			logger.Info("Request handled")
+		}
+		return rss, err
+	})
+}
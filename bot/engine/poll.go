@@ -0,0 +1,16 @@
+package bot
+
+//Poll marks response as a single-answer question which channel may render as native quiz poll.
+//Buttons of the response are options of the poll
+type Poll struct {
+	//Correct is an index of the button with correct answer
+	Correct int
+	//Explanation is shown to the user once poll is answered
+	Explanation string
+}
+
+//WithPoll allows channel to render response as a quiz poll
+func (rs *Response) WithPoll(correct int, explanation string) *Response {
+	rs.Poll = &Poll{Correct: correct, Explanation: explanation}
+	return rs
+}
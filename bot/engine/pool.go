@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+//WorkerPool runs tasks on a bounded number of workers.
+//Tasks with the same key are executed by the same worker one by one in order they've been submitted
+type WorkerPool struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+//NewWorkerPool creates pool of the given number of workers and starts them.
+//Each worker queues up to queueSize tasks, Submit blocks once queue is full
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &WorkerPool{queues: make([]chan func(), workers)}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), queueSize)
+		p.wg.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+//Submit queues task of the given key. Returns false if pool is stopped and task is rejected
+func (p *WorkerPool) Submit(key string, task func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return false
+	}
+	p.queues[p.index(key)] <- task
+	return true
+}
+
+//Stop rejects new tasks and waits until queued ones are executed or context is done
+func (p *WorkerPool) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		for _, q := range p.queues {
+			close(q)
+		}
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *WorkerPool) work(q chan func()) {
+	defer p.wg.Done()
+	for task := range q {
+		task()
+	}
+}
+
+func (p *WorkerPool) index(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOrderPerKey(t *testing.T) {
+	p := NewWorkerPool(4, 2)
+
+	var mu sync.Mutex
+	executed := map[string][]int{}
+	for i := 0; i < 50; i++ {
+		for u := 0; u < 5; u++ {
+			key := fmt.Sprintf("user-%d", u)
+			i := i
+			p.Submit(key, func() {
+				time.Sleep(time.Duration(i%3) * time.Millisecond)
+				mu.Lock()
+				executed[key] = append(executed[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+
+	if err := p.Stop(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	for key, order := range executed {
+		if 50 != len(order) {
+			t.Errorf("%s: expected 50 tasks to be executed, got %d", key, len(order))
+		}
+		for i, n := range order {
+			if i != n {
+				t.Fatalf("%s: tasks are executed out of order: %v", key, order)
+			}
+		}
+	}
+
+	if p.Submit("user-0", func() {}) {
+		t.Error("Expected task to be rejected by stopped pool")
+	}
+}
+
+func TestWorkerPoolStopDeadline(t *testing.T) {
+	p := NewWorkerPool(1, 1)
+	release := make(chan struct{})
+	defer close(release)
+	p.Submit("user", func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Stop(ctx); context.DeadlineExceeded != err {
+		t.Errorf("Expected stop to be interrupted by deadline, got %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+)
+
+type (
+	//Predicate is a routing condition request should satisfy
+	Predicate func(ctx context.Context, rq Request) bool
+
+	//Route binds handler to the condition
+	Route struct {
+		When    Predicate
+		Handler Handler
+	}
+)
+
+//Router is a composite Handler. Dispatches request to the first route which condition is satisfied
+//or to the fallback handler if there is no such route
+func Router(fallback Handler, routes ...Route) Handler {
+	return HandlerFunc(func(ctx context.Context, rq Request) ([]*Response, error) {
+		for _, r := range routes {
+			if r.When(ctx, rq) {
+				return r.Handler.Handle(ctx, rq)
+			}
+		}
+		return fallback.Handle(ctx, rq)
+	})
+}
+
+//IsCallback matches callbacks/answers to some question
+func IsCallback() Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		_, ok := rq.(*CallbackRequest)
+		return ok
+	}
+}
+
+//IsText matches free text typed by the user, regardless of recognized intent
+func IsText() Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		_, ok := rq.(*IntentRequest)
+		return ok
+	}
+}
+
+//IsIntent matches intent with the given name recognized with at least the given confidence
+func IsIntent(name string, confidence float64) Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		irq, ok := rq.(*IntentRequest)
+		return ok && irq.Intent == name && irq.Confidence >= confidence
+	}
+}
+
+//QuestionPending matches requests of users having unanswered question in their session
+func QuestionPending() Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		session, ok := botctx.GetSession(ctx)
+		return ok && len(session.Results) < len(session.Questions)
+	}
+}
+
+//And matches if all the predicates are satisfied
+func And(ps ...Predicate) Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		for _, p := range ps {
+			if !p(ctx, rq) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+//Or matches if any of the predicates is satisfied
+func Or(ps ...Predicate) Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		for _, p := range ps {
+			if p(ctx, rq) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+//Not negates the predicate
+func Not(p Predicate) Predicate {
+	return func(ctx context.Context, rq Request) bool {
+		return !p(ctx, rq)
+	}
+}
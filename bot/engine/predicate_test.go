@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"testing"
+)
+
+func TestRouterFreeTextDuringQuiz(t *testing.T) {
+	answer := respondWith("answer")
+	exit := respondWith("exit")
+	h := Router(respondWith("fallback"),
+		Route{When: IsIntent("exit.intent", 0.8), Handler: exit},
+		Route{When: And(QuestionPending(), Or(IsCallback(), IsText())), Handler: answer},
+	)
+
+	pending := botctx.WithSession(context.Background(), &db.QuizSession{
+		Questions: []*opentdb.Question{{}, {}},
+		Results:   map[int]bool{0: true},
+	})
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		rq   Request
+		exp  string
+	}{
+		{"callback", pending, &CallbackRequest{Raw: "10"}, "answer"},
+		{"free text", pending, &IntentRequest{Raw: "10", Intent: "start.intent", Confidence: 0.6}, "answer"},
+		{"confident exit", pending, &IntentRequest{Raw: "bye", Intent: "exit.intent", Confidence: 0.9}, "exit"},
+		{"unsure exit", pending, &IntentRequest{Raw: "bye", Intent: "exit.intent", Confidence: 0.6}, "answer"},
+		{"no session", context.Background(), &IntentRequest{Raw: "10"}, "fallback"},
+	}
+	for _, c := range cases {
+		rss, err := h.Handle(c.ctx, c.rq)
+		if nil != err {
+			t.Fatalf("%s: unexpected error: %s", c.name, err)
+		}
+		if rss[0].Text.String() != c.exp {
+			t.Errorf("%s: expected to be routed to %s, routed to %s", c.name, c.exp, rss[0].Text)
+		}
+	}
+}
+
+func respondWith(text string) Handler {
+	return NewHandlerFunc(func(ctx context.Context, rq Request) ([]*Response, error) {
+		return Respond(NewResponse().WithText(text)), nil
+	})
+}
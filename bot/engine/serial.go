@@ -0,0 +1,41 @@
+package bot
+
+import "sync"
+
+//userLocks serializes handling of requests of the same user while requests of different users are handled concurrently
+type userLocks struct {
+	mu    sync.Mutex
+	locks map[string]*userLock
+}
+
+//userLock is a lock of a single user. Removed once nobody holds or waits for it
+type userLock struct {
+	sync.Mutex
+	refs int
+}
+
+//lock acquires lock of the user. Returned function releases it
+func (l *userLocks) lock(userID string) func() {
+	l.mu.Lock()
+	if nil == l.locks {
+		l.locks = map[string]*userLock{}
+	}
+	ul, ok := l.locks[userID]
+	if !ok {
+		ul = &userLock{}
+		l.locks[userID] = ul
+	}
+	ul.refs++
+	l.mu.Unlock()
+
+	ul.Lock()
+	return func() {
+		ul.Unlock()
+
+		l.mu.Lock()
+		if ul.refs--; 0 == ul.refs {
+			delete(l.locks, userID)
+		}
+		l.mu.Unlock()
+	}
+}
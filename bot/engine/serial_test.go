@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatchSerializedPerUser(t *testing.T) {
+	var mu sync.Mutex
+	inFlight := map[string]int{}
+	var maxTotal, total int32
+
+	d := &Dispatcher{
+		Handler: NewHandlerFunc(func(ctx context.Context, rq Request) ([]*Response, error) {
+			user := botctx.GetUserID(ctx)
+			mu.Lock()
+			inFlight[user]++
+			concurrent := inFlight[user]
+			mu.Unlock()
+			if concurrent > 1 {
+				t.Errorf("Requests of user %s are handled concurrently", user)
+			}
+
+			if n := atomic.AddInt32(&total, 1); n > atomic.LoadInt32(&maxTotal) {
+				atomic.StoreInt32(&maxTotal, n)
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&total, -1)
+
+			mu.Lock()
+			inFlight[user]--
+			mu.Unlock()
+			return nil, nil
+		}),
+		ErrHandler: ErrorHandlerFunc(func(ctx context.Context, err error) []*Response {
+			t.Errorf("Unexpected error: %s", err)
+			return nil
+		}),
+	}
+
+	var wg sync.WaitGroup
+	for u := 0; u < 4; u++ {
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(user string) {
+				defer wg.Done()
+				d.DispatchRQ(botctx.WithUserID(context.Background(), user), &CallbackRequest{Raw: "1"})
+			}(fmt.Sprintf("user-%d", u))
+		}
+	}
+	wg.Wait()
+
+	if maxTotal < 2 {
+		t.Error("Expected requests of different users to be handled concurrently")
+	}
+	if 0 != len(d.locks.locks) {
+		t.Errorf("Expected user locks to be released, got %d", len(d.locks.locks))
+	}
+}
@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"sync"
+	"time"
+)
+
+//SessionSweeper periodically fires timeouts of dialog flows abandoned by the users.
+//Otherwise flow is timed out only once user writes again, so quizzes of users who walked away are never closed
+type SessionSweeper struct {
+	repo       db.SessionRepo
+	flows      *FlowDispatcher
+	dispatcher *Dispatcher
+	interval   time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+//NewSessionSweeper creates new instance of SessionSweeper. Sessions are swept under the user locks of the dispatcher,
+//so sweeping never races with requests of the same user
+func NewSessionSweeper(repo db.SessionRepo, flows *FlowDispatcher, dispatcher *Dispatcher, interval time.Duration) *SessionSweeper {
+	return &SessionSweeper{
+		repo:       repo,
+		flows:      flows,
+		dispatcher: dispatcher,
+		interval:   interval,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+//Start sweeps sessions every interval until sweeper is stopped
+func (s *SessionSweeper) Start() {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if _, err := s.Sweep(context.Background()); nil != err {
+					log.WithError(err).Error("Cannot sweep sessions")
+				}
+			}
+		}
+	}()
+}
+
+//Stop stops sweeping and waits until in-progress sweep is over or context is done
+func (s *SessionSweeper) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//Sweep fires timeouts of all the expired sessions. Returns number of sessions flow state of which has been changed
+func (s *SessionSweeper) Sweep(ctx context.Context) (int, error) {
+	ids, err := s.repo.IDs(ctx)
+	if nil != err {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		select {
+		case <-s.stop:
+			return expired, nil
+		default:
+		}
+
+		ok, err := s.expire(ctx, id)
+		if nil != err {
+			log.WithError(err).WithField("user_id", id).Error("Cannot expire session")
+			continue
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+//expire fires timeout of the user's session if it's expired
+func (s *SessionSweeper) expire(ctx context.Context, userID string) (bool, error) {
+	unlock := s.dispatcher.locks.lock(userID)
+	defer unlock()
+
+	//session is reloaded under the lock since user may have changed it
+	var session db.QuizSession
+	err := s.repo.Load(ctx, userID, &session)
+	if db.ErrNotFound == err {
+		return false, nil
+	}
+	if nil != err {
+		return false, err
+	}
+
+	ctx = tracing.WithFields(tracing.NewRequest(ctx), log.Fields{"user_id": userID})
+	ctx = botctx.WithUserID(ctx, userID)
+	if "" != session.Event {
+		ctx = botctx.WithEvent(ctx, session.Event)
+	}
+	rss, expired, err := s.flows.Expire(ctx, &session)
+	if expired {
+		//user isn't talking to the bot, so there is nobody to respond to
+		tracing.Logger(ctx).Infof("Session of flow %s is expired. %d responses are dropped", session.Flow, len(rss))
+	}
+	return expired, err
+}
@@ -0,0 +1,81 @@
+package bot
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"testing"
+	"time"
+)
+
+func TestSweepExpiresAbandonedSessions(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	timedOut := 0
+	flow := newTestFlow(nil)
+	flow.States["asking"].Transitions[3].Action = NewHandlerFunc(func(ctx context.Context, rq Request) ([]*Response, error) {
+		timedOut++
+		return nil, nil
+	})
+	flows := NewFlowDispatcher(repo, respondWith("fallback"), flow)
+	sweeper := NewSessionSweeper(repo, flows, &Dispatcher{}, time.Minute)
+
+	ctx := context.Background()
+	abandoned := time.Now().Add(-time.Hour)
+	for _, s := range []*db.QuizSession{
+		{ID: "abandoned", Flow: "test", State: "asking", StateEnteredAt: abandoned},
+		{ID: "active", Flow: "test", State: "asking", StateEnteredAt: time.Now()},
+		{ID: "idle", StateEnteredAt: abandoned},
+	} {
+		if err := repo.Save(ctx, s); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := sweeper.Sweep(ctx)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != expired || 1 != timedOut {
+		t.Errorf("Expected 1 session to be expired, got %d, timeout fired %d times", expired, timedOut)
+	}
+	var session db.QuizSession
+	repo.Load(ctx, "abandoned", &session)
+	if "" != session.Flow {
+		t.Errorf("Expected flow to be over, session is in %s/%s", session.Flow, session.State)
+	}
+	var active db.QuizSession
+	repo.Load(ctx, "active", &active)
+	if "asking" != active.State {
+		t.Errorf("Expected active session to stay in its state, got '%s'", active.State)
+	}
+
+	//flow is over, so there is nothing to expire
+	if expired, _ := sweeper.Sweep(ctx); 0 != expired {
+		t.Errorf("Expected nothing to be expired, got %d", expired)
+	}
+}
+
+func TestSweeperRunsPeriodically(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	flows := NewFlowDispatcher(repo, respondWith("fallback"), newTestFlow(nil))
+	sweeper := NewSessionSweeper(repo, flows, &Dispatcher{}, 10*time.Millisecond)
+
+	ctx := context.Background()
+	repo.Save(ctx, &db.QuizSession{ID: testUser, Flow: "test", State: "asking", StateEnteredAt: time.Now().Add(-time.Hour)})
+	sweeper.Start()
+
+	swept := false
+	for deadline := time.Now().Add(time.Second); !swept && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		var session db.QuizSession
+		repo.Load(ctx, testUser, &session)
+		swept = "" == session.Flow
+	}
+	if !swept {
+		t.Error("Expected session to be swept")
+	}
+
+	stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := sweeper.Stop(stopCtx); nil != err {
+		t.Fatalf("Cannot stop sweeper: %s", err)
+	}
+}
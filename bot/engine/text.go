@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"html"
+	"strings"
+)
+
+//Style is a formatting of the text span
+type Style int
+
+const (
+	//StylePlain is a text without formatting
+	StylePlain Style = iota
+	//StyleBold is a bold text
+	StyleBold
+	//StyleCode is a monospace text
+	StyleCode
+	//StyleLink is a text referencing URL
+	StyleLink
+	//StyleCodeBlock is a multiline monospace snippet
+	StyleCodeBlock
+)
+
+//markdownV2Special are characters which have to be escaped in Telegram MarkdownV2
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+type (
+	//Span is a piece of text with a single style
+	Span struct {
+		Style Style
+		Text  string
+		//URL is a link target. Used by StyleLink only
+		URL string
+		//Language is a programming language of the snippet. Used by StyleCodeBlock only
+		Language string
+	}
+
+	//RichText is a platform-agnostic formatted text. Each channel renders it in its own markup
+	RichText []*Span
+)
+
+//Plain creates span without formatting
+func Plain(text string) *Span {
+	return &Span{Style: StylePlain, Text: text}
+}
+
+//Bold creates bold span
+func Bold(text string) *Span {
+	return &Span{Style: StyleBold, Text: text}
+}
+
+//Code creates monospace span
+func Code(text string) *Span {
+	return &Span{Style: StyleCode, Text: text}
+}
+
+//Link creates span referencing URL
+func Link(text, url string) *Span {
+	return &Span{Style: StyleLink, Text: text, URL: url}
+}
+
+//CodeBlock creates multiline snippet in the given programming language
+func CodeBlock(language, code string) *Span {
+	return &Span{Style: StyleCodeBlock, Text: code, Language: language}
+}
+
+//NewText creates rich text of the spans
+func NewText(spans ...*Span) RichText {
+	return RichText(spans)
+}
+
+//String returns text without any formatting
+func (t RichText) String() string {
+	var b strings.Builder
+	for _, s := range t {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+//MarkdownV2 renders text in Telegram MarkdownV2. Special characters are escaped
+func (t RichText) MarkdownV2() string {
+	var b strings.Builder
+	for _, s := range t {
+		switch s.Style {
+		case StyleBold:
+			b.WriteString("*" + escape(s.Text, markdownV2Special) + "*")
+		case StyleCode:
+			b.WriteString("`" + escape(s.Text, "`\\") + "`")
+		case StyleCodeBlock:
+			b.WriteString("```" + escape(s.Language, "`\\") + "\n" + escape(s.Text, "`\\") + "\n```")
+		case StyleLink:
+			b.WriteString("[" + escape(s.Text, markdownV2Special) + "](" + escape(s.URL, ")\\") + ")")
+		default:
+			b.WriteString(escape(s.Text, markdownV2Special))
+		}
+	}
+	return b.String()
+}
+
+//Slack renders text in Slack mrkdwn. Slack has no escaping of formatting characters,
+//so only control sequences are escaped and backticks are removed from the code
+func (t RichText) Slack() string {
+	var b strings.Builder
+	for _, s := range t {
+		text := slackEscape(s.Text)
+		switch s.Style {
+		case StyleBold:
+			b.WriteString("*" + text + "*")
+		case StyleCode:
+			b.WriteString("`" + strings.Replace(text, "`", "", -1) + "`")
+		case StyleCodeBlock:
+			b.WriteString("```\n" + strings.Replace(text, "```", "", -1) + "\n```")
+		case StyleLink:
+			b.WriteString("<" + slackEscape(s.URL) + "|" + strings.Replace(text, "|", "/", -1) + ">")
+		default:
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
+
+//HTML renders text in HTML. Text and URLs are escaped
+func (t RichText) HTML() string {
+	var b strings.Builder
+	for _, s := range t {
+		text := html.EscapeString(s.Text)
+		switch s.Style {
+		case StyleBold:
+			b.WriteString("<b>" + text + "</b>")
+		case StyleCode:
+			b.WriteString("<code>" + text + "</code>")
+		case StyleCodeBlock:
+			b.WriteString(`<pre><code class="language-` + html.EscapeString(s.Language) + `">` + text + "</code></pre>")
+		case StyleLink:
+			b.WriteString(`<a href="` + html.EscapeString(s.URL) + `">` + text + "</a>")
+		default:
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
+
+//escape prefixes each of the special characters with backslash
+func escape(text, special string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(special, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+//slackEscape escapes characters Slack uses for control sequences
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
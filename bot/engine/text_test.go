@@ -0,0 +1,30 @@
+package bot
+
+import "testing"
+
+func TestRichText(t *testing.T) {
+	text := NewText(
+		Plain("Which of snake_case [names] is (correct)? 2*2=4! "),
+		Bold("get_launch"),
+		Plain(" or "),
+		Code("a`b\\c"),
+		Plain(" <see> "),
+		Link("docs & more", "https://example.com/a_(b)"),
+		CodeBlock("go", "if a < b {}"),
+	)
+
+	for _, c := range []struct {
+		name string
+		got  string
+		exp  string
+	}{
+		{"plain", text.String(), "Which of snake_case [names] is (correct)? 2*2=4! get_launch or a`b\\c <see> docs & moreif a < b {}"},
+		{"markdownV2", text.MarkdownV2(), "Which of snake\\_case \\[names\\] is \\(correct\\)? 2\\*2\\=4\\! *get\\_launch* or `a\\`b\\\\c` <see\\> [docs & more](https://example.com/a_(b\\))```go\nif a < b {}\n```"},
+		{"slack", text.Slack(), "Which of snake_case [names] is (correct)? 2*2=4! *get_launch* or `ab\\c` &lt;see&gt; <https://example.com/a_(b)|docs &amp; more>```\nif a &lt; b {}\n```"},
+		{"html", text.HTML(), "Which of snake_case [names] is (correct)? 2*2=4! <b>get_launch</b> or <code>a`b\\c</code> &lt;see&gt; <a href=\"https://example.com/a_(b)\">docs &amp; more</a><pre><code class=\"language-go\">if a &lt; b {}</code></pre>"},
+	} {
+		if c.exp != c.got {
+			t.Errorf("%s: expected\n%s\ngot\n%s", c.name, c.exp, c.got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/apex/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	//StatusUp means component is healthy
+	StatusUp = "up"
+	//StatusDown means component is unhealthy
+	StatusDown = "down"
+
+	defaultTimeout = 5 * time.Second
+)
+
+type (
+	//Checker checks health of some component
+	Checker interface {
+		Check(ctx context.Context) error
+	}
+
+	//CheckerFunc is an adapter to allow the use of ordinary functions as health checkers
+	CheckerFunc func(ctx context.Context) error
+
+	//Registry is a set of named health checks
+	Registry struct {
+		mu      sync.Mutex
+		checks  []*check
+		timeout time.Duration
+	}
+
+	//Status is a result of single health check
+	Status struct {
+		Name        string     `json:"name"`
+		Status      string     `json:"status"`
+		Latency     string     `json:"latency"`
+		LastError   string     `json:"last_error,omitempty"`
+		LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	}
+
+	//Report is a result of all registered health checks
+	Report struct {
+		Status string    `json:"status"`
+		Checks []*Status `json:"checks"`
+	}
+
+	check struct {
+		name        string
+		checker     Checker
+		lastError   string
+		lastErrorAt *time.Time
+	}
+)
+
+//Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+//NewRegistry creates new instance of Registry
+func NewRegistry() *Registry {
+	return &Registry{timeout: defaultTimeout}
+}
+
+//Register adds named health check to the registry
+func (r *Registry) Register(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, &check{name: name, checker: c})
+}
+
+//Run executes all registered health checks concurrently
+func (r *Registry) Run(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	r.mu.Lock()
+	checks := make([]*check, len(r.checks))
+	copy(checks, r.checks)
+	r.mu.Unlock()
+
+	report := &Report{Status: StatusUp, Checks: make([]*Status, len(checks))}
+
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+	for i, c := range checks {
+		go func(i int, c *check) {
+			defer wg.Done()
+			report.Checks[i] = r.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, s := range report.Checks {
+		if StatusUp != s.Status {
+			report.Status = StatusDown
+		}
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c *check) *Status {
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	latency := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := StatusUp
+	if nil != err {
+		log.WithError(err).Warnf("Health check %s has failed", c.name)
+		status = StatusDown
+		c.lastError = err.Error()
+		c.lastErrorAt = &start
+	}
+	return &Status{
+		Name:        c.name,
+		Status:      status,
+		Latency:     latency.String(),
+		LastError:   c.lastError,
+		LastErrorAt: c.lastErrorAt,
+	}
+}
+
+//LiveHandler reports the application is running
+func LiveHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, rq *http.Request) {
+		writeJSON(w, http.StatusOK, &Report{Status: StatusUp, Checks: []*Status{}})
+	}
+}
+
+//ReadyHandler reports whether all the registered components are healthy
+func (r *Registry) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, rq *http.Request) {
+		report := r.Run(rq.Context())
+		code := http.StatusOK
+		if StatusUp != report.Status {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(body); nil != err {
+		log.WithError(err).Error("health check response error")
+	}
+}
@@ -0,0 +1,54 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyHandler(t *testing.T) {
+	healthy := true
+	r := NewRegistry()
+	r.Register("always", CheckerFunc(func(ctx context.Context) error { return nil }))
+	r.Register("flaky", CheckerFunc(func(ctx context.Context) error {
+		if healthy {
+			return nil
+		}
+		return errors.New("connection refused")
+	}))
+
+	report, code := ready(t, r)
+	if http.StatusOK != code || StatusUp != report.Status {
+		t.Fatalf("expected to be ready, got %d %s", code, report.Status)
+	}
+
+	healthy = false
+	report, code = ready(t, r)
+	if http.StatusServiceUnavailable != code || StatusDown != report.Status {
+		t.Fatalf("expected not to be ready, got %d %s", code, report.Status)
+	}
+	if StatusUp != report.Checks[0].Status || StatusDown != report.Checks[1].Status {
+		t.Errorf("unexpected checks statuses: %s %s", report.Checks[0].Status, report.Checks[1].Status)
+	}
+
+	//last error is kept after recovery
+	healthy = true
+	report, _ = ready(t, r)
+	if StatusUp != report.Checks[1].Status || "connection refused" != report.Checks[1].LastError {
+		t.Errorf("unexpected check status: %s, last error: %s", report.Checks[1].Status, report.Checks[1].LastError)
+	}
+}
+
+func ready(t *testing.T, r *Registry) (*Report, int) {
+	rec := httptest.NewRecorder()
+	r.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); nil != err {
+		t.Fatalf("cannot decode report: %s", err)
+	}
+	return &report, rec.Code
+}
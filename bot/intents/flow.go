@@ -0,0 +1,97 @@
+package intents
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/reporting"
+	"strings"
+	"time"
+)
+
+const (
+	//QuizFlow is a name of quiz dialog flow
+	QuizFlow = "quiz"
+	//StartIntent is an intent which starts the quiz
+	StartIntent = "start.intent"
+
+	//StateIdle is a state of user not participating in quiz
+	StateIdle bot.State = "idle"
+	//StateAsking is a state of user answering quiz questions
+	StateAsking bot.State = "asking"
+
+	quizTimeout = 30 * time.Minute
+	//controlConfidence is a confidence control intents should be recognized with to interrupt the quiz
+	controlConfidence = 0.8
+)
+
+//NewQuizFlow creates quiz dialog flow:
+//start intent asks first question, callbacks are answers, exit intent or timeout quits the quiz
+//Buttons carry signed tokens of the answer options
+func NewQuizFlow(repo db.SessionRepo, reporter reporting.ResultReporter, signer *bot.CallbackSigner) *bot.Flow {
+	start := NewStartQuizHandler(repo, reporter, signer)
+	answer := NewQuizIntentHandler(repo, reporter, signer)
+
+	//while question is pending, any text which isn't a control intent is an answer
+	isAnswer := bot.And(bot.QuestionPending(), bot.Or(bot.IsCallback(), bot.IsText()))
+
+	return &bot.Flow{
+		Name:    QuizFlow,
+		Initial: StateIdle,
+		States: map[bot.State]*bot.StateConfig{
+			StateIdle: {
+				Transitions: []*bot.Transition{
+					{On: bot.EventIntent, Intent: StartIntent, To: StateAsking, Action: start},
+				},
+			},
+			StateAsking: {
+				Timeout: quizTimeout,
+				Transitions: []*bot.Transition{
+					{Guard: bot.IsIntent("exit.intent", controlConfidence), To: StateIdle, Action: NewExitQuizHandler(repo, reporter)},
+					{Guard: bot.IsIntent(StartIntent, controlConfidence), To: StateAsking, Action: start},
+					{Guard: bot.And(isAnswer, isCurrentAnswer(signer), isLastQuestion), To: StateIdle, Action: answer},
+					{Guard: isAnswer, Action: answer},
+					{On: bot.EventTimeout, To: StateIdle, Action: newQuizTimeoutHandler(repo, reporter)},
+				},
+			},
+		},
+	}
+}
+
+//newQuizTimeoutHandler quits quiz abandoned by the user
+func newQuizTimeoutHandler(repo db.SessionRepo, reporter reporting.ResultReporter) bot.Handler {
+	return bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
+		session, ok := botctx.GetSession(ctx)
+		if !ok {
+			return nil, nil
+		}
+		if err := quiteSessionGracefully(ctx, repo, reporter, session, reporting.AbortTimeout); nil != err {
+			return nil, err
+		}
+		return bot.Respond(bot.NewResponse().WithText("Your previous quiz has been closed due to inactivity")), nil
+	})
+}
+
+//isCurrentAnswer checks whether answer refers to the pending question. Free text does unless it's replayed after
+//restart, while button may belong to some previous question, e.g. if it's clicked twice. Such answers must not finish the quiz
+func isCurrentAnswer(signer *bot.CallbackSigner) bot.Predicate {
+	return func(ctx context.Context, rq bot.Request) bool {
+		session, ok := botctx.GetSession(ctx)
+		if !ok || isReplayed(ctx, session) {
+			return false
+		}
+		if _, ok := rq.(*bot.CallbackRequest); !ok {
+			return true
+		}
+		token, valid := signer.Verify(session.ID, strings.TrimSpace(rq.GetRaw()))
+		_, current := session.Options[token]
+		return valid && current
+	}
+}
+
+//isLastQuestion checks whether user answers the last question of the quiz
+func isLastQuestion(ctx context.Context, rq bot.Request) bool {
+	session, ok := botctx.GetSession(ctx)
+	return ok && len(session.Results) >= len(session.Questions)-1
+}
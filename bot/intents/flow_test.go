@@ -0,0 +1,147 @@
+package intents
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/reporting"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testUser = "user"
+
+func TestStaleClicksDoNotFinishQuiz(t *testing.T) {
+	useQuestions(t, `{"results": [
+		{"category": "Test", "question": "First", "correct_answer": "A", "incorrect_answers": ["B"]},
+		{"category": "Test", "question": "Second", "correct_answer": "C", "incorrect_answers": ["D"]}
+	]}`)
+
+	repo := db.NewMemorySessionRepo()
+	signer, _ := bot.NewCallbackSigner([]byte("secret"))
+	d := bot.NewFlowDispatcher(repo, bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
+		return bot.Respond(bot.NewResponse().WithText("fallback")), nil
+	}), NewQuizFlow(repo, reporting.Noop{}, signer))
+
+	rss := dispatch(t, d, repo, &bot.IntentRequest{Intent: StartIntent, Confidence: 0.9})
+	first := rss[len(rss)-1]
+
+	//first question is sent as a poll, but answered by button
+	repo.Patch(context.Background(), testUser, db.SetPoll(&db.Poll{ID: "poll"}))
+
+	//first question is answered, the second one is asked
+	rss = dispatch(t, d, repo, &bot.CallbackRequest{Raw: first.Buttons[0].Data})
+	second := rss[len(rss)-1]
+	var asked db.QuizSession
+	repo.Load(context.Background(), testUser, &asked)
+	if nil != asked.Poll {
+		t.Errorf("Expected poll of the answered question to be cleared, got %+v", asked.Poll)
+	}
+	//questions are shuffled, so the order isn't known
+	if 0 == len(second.Buttons) || first.Text.String() == second.Text.String() {
+		t.Fatalf("Expected next question to be asked, got %s", second.Text)
+	}
+
+	//button of the first question is clicked twice while the last question is pending
+	rss = dispatch(t, d, repo, &bot.CallbackRequest{Raw: first.Buttons[0].Data})
+	if !strings.Contains(rss[0].Text.String(), "already been answered") {
+		t.Errorf("Expected stale answer to be rejected, got %s", rss[0].Text)
+	}
+	var session db.QuizSession
+	if err := repo.Load(context.Background(), testUser, &session); nil != err {
+		t.Fatalf("Expected quiz to be in progress: %s", err)
+	}
+	if QuizFlow != session.Flow || string(StateAsking) != session.State {
+		t.Errorf("Expected quiz to be in progress, session is in '%s/%s'", session.Flow, session.State)
+	}
+
+	//button signed with some other key, e.g. before the key is changed
+	rss = dispatch(t, d, repo, &bot.CallbackRequest{Raw: "token.forgedsignat"})
+	if !strings.Contains(rss[0].Text.String(), "already been answered") {
+		t.Errorf("Expected invalid button to be rejected, got %s", rss[0].Text)
+	}
+
+	//last question is answered and quiz is finished
+	rss = dispatch(t, d, repo, &bot.CallbackRequest{Raw: second.Buttons[0].Data})
+	if !strings.Contains(rss[1].Text.String(), "You passed a quiz") {
+		t.Errorf("Expected quiz to be finished, got %s", rss[1].Text)
+	}
+	if err := repo.Load(context.Background(), testUser, &db.QuizSession{}); db.ErrNotFound != err {
+		t.Errorf("Expected session to be removed, got %v", err)
+	}
+}
+
+func TestReplayedAnswerIsRecordedOnce(t *testing.T) {
+	useQuestions(t, `{"results": [
+		{"category": "Test", "question": "First", "correct_answer": "A", "incorrect_answers": ["B"]},
+		{"category": "Test", "question": "Second", "correct_answer": "A", "incorrect_answers": ["B"]}
+	]}`)
+
+	repo := db.NewMemorySessionRepo()
+	signer, _ := bot.NewCallbackSigner([]byte("secret"))
+	d := bot.NewFlowDispatcher(repo, bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
+		return bot.Respond(bot.NewResponse().WithText("fallback")), nil
+	}), NewQuizFlow(repo, reporting.Noop{}, signer))
+
+	dispatch(t, d, repo, &bot.IntentRequest{Intent: StartIntent, Confidence: 0.9})
+	answer := &bot.IntentRequest{Raw: "A"}
+	if rss := dispatchUpdate(t, d, repo, 10, answer); 0 == len(rss) {
+		t.Fatal("Expected answer to be handled")
+	}
+
+	//update is handled again after restart
+	if rss := dispatchUpdate(t, d, repo, 10, answer); 0 != len(rss) {
+		t.Errorf("Expected replayed answer to be skipped, got %s", rss[0].Text)
+	}
+	var session db.QuizSession
+	if err := repo.Load(context.Background(), testUser, &session); nil != err {
+		t.Fatalf("Expected quiz to be in progress: %s", err)
+	}
+	if 1 != len(session.Results) || 10 != session.UpdateID {
+		t.Errorf("Expected single answer of update 10 to be recorded, got %v of update %d", session.Results, session.UpdateID)
+	}
+
+	//next update answers the last question
+	rss := dispatchUpdate(t, d, repo, 11, answer)
+	if 2 > len(rss) || !strings.Contains(rss[1].Text.String(), "You passed a quiz") {
+		t.Errorf("Expected quiz to be finished, got %v", rss)
+	}
+}
+
+//dispatch handles request of the test user loading its session the same way dispatcher middleware does
+func dispatch(t *testing.T, d bot.Handler, repo db.SessionRepo, rq bot.Request) []*bot.Response {
+	rss := dispatchUpdate(t, d, repo, 0, rq)
+	if 0 == len(rss) {
+		t.Fatal("Expected responses")
+	}
+	return rss
+}
+
+//dispatchUpdate handles request made of the channel update with the given ID
+func dispatchUpdate(t *testing.T, d bot.Handler, repo db.SessionRepo, updateID int, rq bot.Request) []*bot.Response {
+	ctx := botctx.WithUserID(context.Background(), testUser)
+	ctx = botctx.WithUpdateID(ctx, updateID)
+	var session db.QuizSession
+	if err := repo.Load(ctx, testUser, &session); nil == err {
+		ctx = botctx.WithSession(ctx, &session)
+	}
+	rss, err := d.Handle(ctx, rq)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return rss
+}
+
+//useQuestions makes questions file of the given content a source of the quiz questions
+func useQuestions(t *testing.T, questions string) {
+	f, err := ioutil.TempFile("", "questions")
+	if nil != err {
+		t.Fatal(err)
+	}
+	f.WriteString(questions)
+	f.Close()
+	os.Setenv("QUESTION_FILE", f.Name())
+}
@@ -3,22 +3,37 @@ package intents
 import (
 	"context"
 	"fmt"
-	"github.com/apex/log"
 	"github.com/avarabyeu/rpquiz/bot/db"
 	"github.com/avarabyeu/rpquiz/bot/engine"
 	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
-	"github.com/avarabyeu/rpquiz/bot/rp"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"github.com/avarabyeu/rpquiz/bot/reporting"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
 	"github.com/pkg/errors"
 	"math/rand"
 	"net/url"
 	"strings"
-	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"time"
+)
+
+const (
+	questionsCount = 6
+	//revealDelay paces result messages once quiz is finished
+	revealDelay = time.Second
 )
 
-const questionsCount = 6
+var (
+	//errAnswered is returned when answer refers to the question which is already answered
+	errAnswered = errors.New("question is already answered")
+	//errInvalidCallback is returned when button signature doesn't match, e.g. it's signed with a key
+	//which has been changed since then
+	errInvalidCallback = errors.New("callback signature is invalid")
+	//errReplayed is returned when answer is made of the update which has been recorded already
+	errReplayed = errors.New("update is already recorded")
+)
 
 //NewStartQuizHandler creates new start intent handler - greeting and first question
-func NewStartQuizHandler(repo db.SessionRepo, rp *rp.Reporter) bot.Handler {
+func NewStartQuizHandler(repo db.SessionRepo, reporter reporting.ResultReporter, signer *bot.CallbackSigner) bot.Handler {
 	return bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
 		userID := botctx.GetUserID(ctx)
 		if "" == userID {
@@ -26,75 +41,78 @@ func NewStartQuizHandler(repo db.SessionRepo, rp *rp.Reporter) bot.Handler {
 		}
 
 		//if old session is still started, quit it gracefully.
-		if oldSession, ok := botctx.GetSession(ctx); ok && "" != oldSession.LaunchID {
-			if err := quiteSessionGracefully(repo, rp, oldSession); nil != err {
+		if oldSession, ok := botctx.GetSession(ctx); ok && len(oldSession.Questions) > 0 {
+			if err := quiteSessionGracefully(ctx, repo, reporter, oldSession, reporting.AbortRestart); nil != err {
 				return nil, err
 			}
 		}
 
-		userName := botctx.GetUserName(ctx)
+		//deep link may select quiz and event
+		var params map[string]string
+		if irq, ok := rq.(*bot.IntentRequest); ok {
+			params = irq.Params
+		}
+		quiz, referral := params[bot.DeepLinkQuiz], params[bot.DeepLinkRef]
+		if event := params[bot.DeepLinkEvent]; "" != event {
+			ctx = botctx.WithEvent(ctx, event)
+		}
 
-		log.Infof("Starting new quiz for %s[%s]", userName, userID)
+		userName := botctx.GetUserName(ctx)
+		tracing.Logger(ctx).Infof("Starting new quiz '%s' for %s[%s], event '%s', referral '%s'",
+			quiz, userName, userID, botctx.GetEvent(ctx), referral)
 		//handle start, first question
 
-		questions, err := opentdb.GetPredefinedQuestions(questionsCount)
+		questions, err := opentdb.GetQuizQuestions(questionsCount, quiz)
 		if err != nil {
 			return nil, err
 		}
 		if len(questions) < 1 {
+			if "" != quiz {
+				return bot.Respond(bot.NewResponse().WithText(fmt.Sprintf("Sorry, there is no quiz '%s'", quiz))), nil
+			}
 			return nil, errors.New("Questions for a quiz cannot be retrieved")
 		}
 
+		//grab the very first question
+		q, options, err := askQuestion(signer, userID, questions[0])
+		if nil != err {
+			return nil, err
+		}
+
 		session := &db.QuizSession{
-			ID:        userID,
-			Questions: questions,
-			Results:   map[int]bool{},
+			ID:              userID,
+			Questions:       questions,
+			Quiz:            quiz,
+			Event:           botctx.GetEvent(ctx),
+			Referral:        referral,
+			Results:         map[int]bool{},
+			Options:         options,
+			QuestionAskedAt: time.Now(),
 		}
-		err = repo.Save(session)
+		//reporters may keep their state in the session, so report before it's saved
+		reporter.QuizStarted(ctx, session)
+		reporter.QuestionAsked(ctx, session, 0, optionsOf(q))
+
+		err = repo.Save(ctx, session)
 		if err != nil {
 			return nil, err
 		}
 
-		//grab the very first question
-		q := askQuestion(questions[0])
-
-		//start launch and root suite in RP
-		rp.StartLaunch(fmt.Sprintf("SEC-RP-quiz: %s", userName), func(launchID, sID string, e error) error {
-			if err != nil {
-				return err
-			}
-			//start test in RP
-			rp.StartTest(launchID, sID, q.Text, func(testID string, e error) {
-				repo.Update(&db.QuizSession{
-					ID:       userID,
-					TestID:   testID,
-					SuiteID:  sID,
-					LaunchID: launchID,
-				})
-				if err != nil {
-					log.WithError(err).Error("Cannot create test suite")
-				}
-			})
-
-			return nil
-
-		})
-
 		return bot.Respond(bot.NewResponse().WithText(fmt.Sprintf("Hi %s! We are starting a new quiz!", userName)), q), nil
 	})
 }
 
 //NewExitQuizHandler creates new intent handler that processes quit from quiz
-func NewExitQuizHandler(repo db.SessionRepo, rp *rp.Reporter) bot.Handler {
+func NewExitQuizHandler(repo db.SessionRepo, reporter reporting.ResultReporter) bot.Handler {
 	return bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
-		if irq, ok := rq.(*bot.IntentRequest); ok && irq.Confidence >= 0.8 {
+		if irq, ok := rq.(*bot.IntentRequest); ok && irq.Confidence >= controlConfidence {
 
 			session, ok := botctx.GetSession(ctx)
 			if !ok {
 				return nil, errors.Errorf("Quiz for user %s not found", botctx.GetUserName(ctx))
 			}
 
-			if err := quiteSessionGracefully(repo, rp, session); nil != err {
+			if err := quiteSessionGracefully(ctx, repo, reporter, session, reporting.AbortExit); nil != err {
 				return nil, err
 			}
 			return bot.Respond(bot.NewResponse().WithText("Thanks for quizzing!")), nil
@@ -106,13 +124,14 @@ func NewExitQuizHandler(repo db.SessionRepo, rp *rp.Reporter) bot.Handler {
 
 //QuizIntentHandler handles answer to a question
 type QuizIntentHandler struct {
-	repo db.SessionRepo
-	rp   *rp.Reporter
+	repo     db.SessionRepo
+	reporter reporting.ResultReporter
+	signer   *bot.CallbackSigner
 }
 
 //NewQuizIntentHandler creates new instance of a handler
-func NewQuizIntentHandler(repo db.SessionRepo, rp *rp.Reporter) *QuizIntentHandler {
-	return &QuizIntentHandler{repo: repo, rp: rp}
+func NewQuizIntentHandler(repo db.SessionRepo, reporter reporting.ResultReporter, signer *bot.CallbackSigner) *QuizIntentHandler {
+	return &QuizIntentHandler{repo: repo, reporter: reporter, signer: signer}
 }
 
 //Handle handles answer to a question
@@ -128,14 +147,24 @@ func (h *QuizIntentHandler) Handle(ctx context.Context, rq bot.Request) ([]*bot.
 		//handle answer to the previous question
 		var text string
 		var err error
-		if text, err = h.handleAnswer(rq, session, currQuestion); nil != err {
-			log.WithError(err).Error("Answer handling error")
+		if text, err = h.handleAnswer(ctx, rq, session, currQuestion); nil != err {
+			if errReplayed == err {
+				//user has got the reply before restart
+				tracing.Logger(ctx).Debug("Replayed answer is skipped")
+				return nil, nil
+			}
+			if errAnswered == err || errInvalidCallback == err {
+				//e.g. button of the previous question is clicked twice
+				tracing.Logger(ctx).WithError(err).Debug("Stale answer is ignored")
+				return bot.Respond(bot.NewResponse().WithText("This question has already been answered")), nil
+			}
+			tracing.Logger(ctx).WithError(err).Error("Answer handling error")
 			return nil, errors.WithStack(err)
 		}
 
 		// not a last question. Ask next one
 		if currQuestion < len(session.Questions)-1 {
-			newQuestion, err := h.handleNewQuestion(session, currQuestion)
+			newQuestion, err := h.handleNewQuestion(ctx, session, currQuestion)
 			if nil != err {
 				return nil, err
 			}
@@ -143,22 +172,17 @@ func (h *QuizIntentHandler) Handle(ctx context.Context, rq bot.Request) ([]*bot.
 		}
 
 		// handle last question. close session
-		log.Debug("Handling last question")
-		if err := h.repo.Delete(session.ID); nil != err {
+		tracing.Logger(ctx).Debug("Handling last question")
+		if err := h.repo.Delete(ctx, session.ID); nil != err {
 			return nil, err
 		}
-		h.rp.FinishLaunch(session.LaunchID, session.SuiteID, true, func(err error) {
-			if err != nil {
-				log.WithError(err).Error("Cannot finish launch")
-			}
-		})
+		h.reporter.QuizFinished(ctx, session)
 
-		return bot.Respond(bot.NewResponse().WithText(text), bot.NewResponse().
-			WithText(fmt.Sprintf("Thank you! You passed a quiz! Your score is %d", calculateScore(session))),
-			bot.NewResponse().
-				WithText(fmt.Sprintf("Don't forget to star us!\n%s",
-				markdownLink("https://github.com/reportportal/reportportal"))),
-			bot.NewResponse().WithText(markdownLink("https://github.com/avarabyeu/rpquiz"))), nil
+		return bot.Respond(bot.NewResponse().WithText(text), bot.NewResponse().WithTyping(revealDelay).
+			WithText(fmt.Sprintf("Thank you! You passed a quiz! Your score is %d", reporting.Score(session))),
+			bot.NewResponse().WithDelay(revealDelay).WithText("Don't forget to star us!").WithColumns(2).WithButtons(
+				bot.NewURLButton("ReportPortal", "https://github.com/reportportal/reportportal"),
+				bot.NewURLButton("RP Quiz", "https://github.com/avarabyeu/rpquiz"))), nil
 
 	}
 
@@ -166,106 +190,168 @@ func (h *QuizIntentHandler) Handle(ctx context.Context, rq bot.Request) ([]*bot.
 	return bot.Respond(bot.NewResponse().WithText("hm..")), nil
 }
 
-func (h *QuizIntentHandler) handleNewQuestion(session *db.QuizSession, currQuestion int) (*bot.Response, error) {
-	log.Debug("Handling question")
-
-	newQuestion := askQuestion(session.Questions[currQuestion+1])
+func (h *QuizIntentHandler) handleNewQuestion(ctx context.Context, session *db.QuizSession, currQuestion int) (*bot.Response, error) {
+	tracing.Logger(ctx).Debug("Handling question")
 
-	h.rp.StartTest(session.LaunchID, session.SuiteID, newQuestion.Text, func(testID string, err error) {
-		if nil != err {
-			log.WithError(err).Error("Cannot start test in RP")
-			return
-		}
+	newQuestion, options, err := askQuestion(h.signer, session.ID, session.Questions[currQuestion+1])
+	if nil != err {
+		return nil, err
+	}
 
-		if err := h.repo.Update(&db.QuizSession{
-			ID:      session.ID,
-			SuiteID: session.SuiteID,
-			TestID:  testID,
-		}); nil != err {
-			log.WithError(err).Error("Cannot update session in DB")
-		}
-	})
-	//testID, err := h.rp.StartTest(session.LaunchID, newQuestion.Text)
+	session.Options = options
+	session.QuestionAskedAt = time.Now()
+	h.reporter.QuestionAsked(ctx, session, currQuestion+1, optionsOf(newQuestion))
+	if err := h.repo.Patch(ctx, session.ID,
+		db.SetTestID(session.TestID),
+		db.SetSuites(session.Suites),
+		db.SetOptions(session.Options),
+		//poll of the previous question, if any, is over. Poll of the new one is set once it's sent
+		db.SetPoll(nil),
+		db.SetQuestionAskedAt(session.QuestionAskedAt)); nil != err {
+		return nil, err
+	}
 
 	return newQuestion, nil
 }
 
-func (h *QuizIntentHandler) handleAnswer(rq bot.Request, session *db.QuizSession, currQuestion int) (string, error) {
-	answer := rq.GetRaw()
-	if nil == session.Results {
-		session.Results = map[int]bool{}
+func (h *QuizIntentHandler) handleAnswer(ctx context.Context, rq bot.Request, session *db.QuizSession, currQuestion int) (string, error) {
+	if isReplayed(ctx, session) {
+		return "", errReplayed
+	}
+	answer := strings.TrimSpace(rq.GetRaw())
+	question := session.Questions[currQuestion]
+	if _, ok := rq.(*bot.CallbackRequest); ok {
+		token, valid := h.signer.Verify(session.ID, answer)
+		if !valid {
+			return "", errInvalidCallback
+		}
+		option, ok := session.Options[token]
+		if !ok {
+			//button of some previous question
+			return "", errAnswered
+		}
+		answer = option
 	}
-	correctAnswer, err := url.PathUnescape(session.Questions[currQuestion].CorrectAnswer)
+	correctAnswer, err := url.PathUnescape(question.CorrectAnswer)
 	if nil != err {
 		return "", err
 	}
 
-	passed := strings.EqualFold(answer, correctAnswer)
-	session.Results[currQuestion] = passed
-	h.repo.Update(&db.QuizSession{
-		ID:      session.ID,
-		Results: session.Results,
-		SuiteID: session.SuiteID,
-	})
-
-	h.rp.FinishTest(session.TestID, passed, func(err error) {
-		if err != nil {
-			log.WithError(err).Error("Cannot finish Test")
-		} else {
-			log.Debugf("Test %s has been finished", session.TestID)
+	passed := strings.EqualFold(answer, strings.TrimSpace(correctAnswer))
+	err = h.repo.UpdateFunc(ctx, session.ID, func(s *db.QuizSession) error {
+		if isReplayed(ctx, s) {
+			return errReplayed
+		}
+		if len(s.Results) != currQuestion {
+			//answered concurrently
+			return errAnswered
 		}
+		db.SetResult(currQuestion, passed)(s)
+		if updateID := botctx.GetUpdateID(ctx); 0 != updateID {
+			db.SetUpdateID(updateID)(s)
+		}
+		return nil
 	})
+	if nil != err {
+		return "", err
+	}
+	if nil == session.Results {
+		session.Results = map[int]bool{}
+	}
+	session.Results[currQuestion] = passed
+
+	h.reporter.QuestionAnswered(ctx, session, currQuestion, answer, passed)
 
 	return getAnswerText(passed, correctAnswer), nil
 
 }
 
-func askQuestion(q *opentdb.Question) *bot.Response {
-	qText, _ := url.PathUnescape(q.Question)
-	rs := bot.NewResponse().WithText(qText)
-	var btns []*bot.Button
-	if len(q.IncorrectAnswers) > 0 {
-		btns = make([]*bot.Button, len(q.IncorrectAnswers)+1)
-		for i, btn := range q.IncorrectAnswers {
-			btnText, _ := url.PathUnescape(btn)
-			btns[i] = &bot.Button{
-				Data: btnText,
-				Text: btnText,
-			}
-		}
-		rs.WithButtons(btns...)
-	}
-	if len(btns) == 0 {
-		btns = make([]*bot.Button, 1)
+//isReplayed checks whether request is made of the update answer of which is recorded already,
+//e.g. update is handled again after restart
+func isReplayed(ctx context.Context, session *db.QuizSession) bool {
+	updateID := botctx.GetUpdateID(ctx)
+	return 0 != updateID && updateID <= session.UpdateID
+}
+
+//askQuestion creates response with the question and option buttons. Buttons carry signed tokens
+//since options may exceed callback data limits. Returns tokens mapped to the options
+func askQuestion(signer *bot.CallbackSigner, userID string, q *opentdb.Question) (*bot.Response, map[string]string, error) {
+	rs, err := questionOf(q)
+	if nil != err {
+		return nil, nil, err
 	}
-	correctAnswerText, _ := url.PathUnescape(q.CorrectAnswer)
 
-	btns[len(btns)-1] = &bot.Button{
-		Data: correctAnswerText,
-		Text: correctAnswerText,
+	answers := append([]string{q.CorrectAnswer}, q.IncorrectAnswers...)
+	btns := make([]*bot.Button, len(answers))
+	options := make(map[string]string, len(answers))
+	for i, answer := range answers {
+		text, _ := url.PathUnescape(answer)
+		token, err := bot.NewToken()
+		if nil != err {
+			return nil, nil, err
+		}
+		options[token] = strings.TrimSpace(text)
+		btns[i] = &bot.Button{
+			Data: signer.Sign(userID, token),
+			Text: text,
+		}
 	}
+	correct := btns[0]
 
 	//shuffle the array
 	rand.Shuffle(len(btns), func(i, j int) {
 		btns[i], btns[j] = btns[j], btns[i]
 	})
+	for i, btn := range btns {
+		if correct == btn {
+			rs.WithPoll(i, q.Explanation)
+		}
+	}
 
-	return rs
+	return rs.WithButtons(btns...), options, nil
 }
 
-func quiteSessionGracefully(repo db.SessionRepo, rp *rp.Reporter, session *db.QuizSession) error {
-	if err := repo.Delete(session.ID); err != nil {
-		return err
+//questionOf creates response with the question text, code snippet and attachments of the question
+func questionOf(q *opentdb.Question) (*bot.Response, error) {
+	qText, _ := url.PathUnescape(q.Question)
+	rs := bot.NewResponse().WithText(qText)
+	if "" != q.Code {
+		rs.Text = append(rs.Text, bot.Plain("\n"), bot.CodeBlock(q.CodeLanguage, q.Code))
 	}
 
-	rp.FinishLaunch(session.LaunchID, session.SuiteID, false, func(err error) {
+	for _, a := range []struct {
+		kind   bot.AttachmentKind
+		source string
+	}{{bot.AttachmentImage, q.Image}, {bot.AttachmentDocument, q.Document}} {
+		if "" == a.source {
+			continue
+		}
+		attachment, err := bot.NewAttachment(a.kind, a.source)
 		if nil != err {
-			log.WithError(err).Error("Cannot finish launch")
+			return nil, errors.Wrapf(err, "incorrect %s of the question '%s'", a.kind, qText)
 		}
-	})
+		rs.WithAttachments(attachment)
+	}
+	return rs, nil
+}
+
+func quiteSessionGracefully(ctx context.Context, repo db.SessionRepo, reporter reporting.ResultReporter, session *db.QuizSession, reason string) error {
+	if err := repo.Delete(ctx, session.ID); err != nil {
+		return err
+	}
+	reporter.QuizAborted(ctx, session, reason)
 	return nil
 }
 
+//optionsOf collects answer options shown to the user
+func optionsOf(rs *bot.Response) []string {
+	options := make([]string, len(rs.Buttons))
+	for i, btn := range rs.Buttons {
+		options[i] = strings.TrimSpace(btn.Text)
+	}
+	return options
+}
+
 func getAnswerText(passed bool, correctAnswer string) (text string) {
 
 	if passed {
@@ -280,17 +366,3 @@ func getAnswerText(passed bool, correctAnswer string) (text string) {
 
 	return
 }
-
-func calculateScore(s *db.QuizSession) int {
-	score := 0
-	for _, success := range s.Results {
-		if success {
-			score++
-		}
-	}
-	return score
-}
-
-func markdownLink(url string) string {
-	return fmt.Sprintf("[%s](%s)", url, url)
-}
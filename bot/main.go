@@ -5,41 +5,105 @@ import (
 	"fmt"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/cli"
-	"github.com/asdine/storm"
-	"github.com/avarabyeu/gorp/gorp"
+	"github.com/apex/log/handlers/json"
+	"github.com/asdine/storm/v3"
+	"github.com/avarabyeu/rpquiz/bot/admin"
 	"github.com/avarabyeu/rpquiz/bot/db"
 	"github.com/avarabyeu/rpquiz/bot/engine"
 	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/health"
 	"github.com/avarabyeu/rpquiz/bot/intents"
+	"github.com/avarabyeu/rpquiz/bot/metrics"
 	"github.com/avarabyeu/rpquiz/bot/nlp"
+	"github.com/avarabyeu/rpquiz/bot/reporting"
 	"github.com/avarabyeu/rpquiz/bot/rp"
 	"github.com/avarabyeu/rpquiz/bot/telegram"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
 	"github.com/caarlos0/env"
-	"github.com/coreos/bbolt"
 	"github.com/go-chi/chi"
+	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
 	"go.uber.org/fx"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 type (
 	conf struct {
-		LoggingLevel string `env:"LOGGING_LEVEL" envDefault:"info"`
-		Port         int    `env:"PORT" envDefault:"4200"`
-		RpUUID       string `env:"RP_UUID,required"`
-		RpProject    string `env:"RP_PROJECT,required"`
-		RpHost       string `env:"RP_HOST" envDefault:"https://rp.epam.com"`
+		LoggingLevel  string `env:"LOGGING_LEVEL" envDefault:"info"`
+		LoggingFormat string `env:"LOGGING_FORMAT" envDefault:"cli"`
+		Port          int    `env:"PORT" envDefault:"4200"`
+		RpUUID        string `env:"RP_UUID"`
+		RpProject     string `env:"RP_PROJECT"`
+		RpHost        string `env:"RP_HOST" envDefault:"https://rp.epam.com"`
+		//RpLaunchMode is either 'user' (launch per quiz) or 'event' (one launch per event with suite per user)
+		RpLaunchMode string `env:"RP_LAUNCH_MODE" envDefault:"user"`
+		//RpReportSkipped enables reporting questions left unanswered in aborted quiz as skipped
+		RpReportSkipped bool `env:"RP_REPORT_SKIPPED" envDefault:"false"`
+		//RpDefects maps wrong answers, timeouts and aborts to RP issue types
+		RpDefects string `env:"RP_DEFECTS"`
+
+		//Reporters is a list of reporters quiz results are sent to: rp, file, junit or none
+		Reporters []string `env:"REPORTERS" envDefault:"rp" envSeparator:","`
+		//ReportFile is a file results are appended to by the file reporter
+		ReportFile string `env:"REPORT_FILE" envDefault:"results.jsonl"`
+		//JUnitDir is a directory JUnit reports are written to by the junit reporter
+		JUnitDir string `env:"JUNIT_DIR" envDefault:"junit"`
+		//ResultsTTL is a time finished quiz is kept for export by the junit reporter. Zero means no limit
+		ResultsTTL time.Duration `env:"RESULTS_TTL" envDefault:"720h"`
+		//ResultsMax is a max number of finished quizzes kept for export by the junit reporter. Zero means no limit
+		ResultsMax int `env:"RESULTS_MAX" envDefault:"10000"`
 
 		//DB settings
 		DbFile string `env:"DB_FILE" envDefault:"qabot.db"`
+		//DbDriver is a storage of user sessions: bolt, redis or memory
+		DbDriver string `env:"DB_DRIVER" envDefault:"bolt"`
+		//RedisURL is a URL of Redis sessions are stored in if DB driver is redis
+		RedisURL string `env:"REDIS_URL" envDefault:"redis://localhost:6379/0"`
+		//SessionTTL is a time Redis keeps session after the last change
+		SessionTTL time.Duration `env:"SESSION_TTL" envDefault:"24h"`
+		//SessionSweepInterval is how often abandoned sessions are looked for and timed out
+		SessionSweepInterval time.Duration `env:"SESSION_SWEEP_INTERVAL" envDefault:"1m"`
 
 		//NLP settings
 		NlpURL string `env:"NLP_URL" envDefault:"http://localhost:5000"`
 
 		//Telegram
 		TelegramToken string `env:"TG_TOKEN,required"`
+		//TelegramWorkers is a number of updates handled concurrently
+		TelegramWorkers int `env:"TG_WORKERS" envDefault:"8"`
+		//CallbackSecret is a key callback data of the buttons is signed with
+		CallbackSecret string `env:"CALLBACK_SECRET"`
+		//TelegramRateLimit is a max number of messages sent per second to all the chats
+		TelegramRateLimit float64 `env:"TG_RATE_LIMIT" envDefault:"30"`
+		//TelegramChatRateLimit is a max number of messages sent per second to a single chat
+		TelegramChatRateLimit float64 `env:"TG_CHAT_RATE_LIMIT" envDefault:"1"`
+		//TelegramChatBurst is a number of messages chat may receive at once
+		TelegramChatBurst int `env:"TG_CHAT_BURST" envDefault:"4"`
+		//TelegramQuizPolls enables sending questions as native Telegram quiz polls
+		TelegramQuizPolls bool `env:"TG_QUIZ_POLLS" envDefault:"false"`
+		//TelegramPollOpenPeriod is time user has to answer the quiz poll. Zero means no limit
+		TelegramPollOpenPeriod time.Duration `env:"TG_POLL_OPEN_PERIOD" envDefault:"0s"`
+
+		//EventName is a name of the event (e.g. conference) quiz is held at
+		EventName string `env:"EVENT_NAME"`
+
+		//Tracing settings
+		TracingExporter string `env:"TRACING_EXPORTER" envDefault:"none"`
+		TracingEndpoint string `env:"TRACING_ENDPOINT" envDefault:"localhost:4318"`
+
+		//AdminAddr is an address admin API is served on. It should not be exposed publicly
+		AdminAddr string `env:"ADMIN_ADDR" envDefault:"127.0.0.1:4201"`
+		//AdminToken is a bearer token admin API requests are authorized with. Admin API is disabled if it's not set
+		AdminToken string `env:"ADMIN_TOKEN"`
+	}
+
+	//adminRouter serves admin API on the admin address
+	adminRouter struct {
+		chi.Router
 	}
 )
 
@@ -48,13 +112,21 @@ func main() {
 		fx.Provide(
 			newConf,
 			newMux,
+			newAdminRouter,
+			health.NewRegistry,
+			newStormDB,
+			newRedisClient,
 			newSessionRepo,
-			newRPReporter,
+			newUpdateLog,
+			newResultStore,
+			newResultReporter,
 			newTelegramBot,
+			newCallbackSigner,
+			newFlowDispatcher,
 			newIntentDispatcher,
 			newIntentParser,
 		),
-		fx.Invoke(initLogger, register),
+		fx.Invoke(initLogger, initTracing, initSessionSweeper, register),
 	)
 
 	app.Run()
@@ -71,11 +143,28 @@ func initLogger(c *conf) error {
 	if err != nil {
 		return err
 	}
-	log.SetHandler(cli.New(os.Stdout))
+	if "json" == c.LoggingFormat {
+		log.SetHandler(json.New(os.Stdout))
+	} else {
+		log.SetHandler(cli.New(os.Stdout))
+	}
 	log.SetLevel(level)
 	return nil
 }
 
+func initTracing(lc fx.Lifecycle, c *conf) error {
+	shutdown, err := tracing.Init(context.Background(), c.TracingExporter, c.TracingEndpoint)
+	if nil != err {
+		return err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return shutdown(ctx)
+		},
+	})
+	return nil
+}
+
 func newMux(lc fx.Lifecycle, cfg *conf) chi.Router {
 	mux := chi.NewRouter()
 
@@ -98,32 +187,136 @@ func newMux(lc fx.Lifecycle, cfg *conf) chi.Router {
 	return mux
 }
 
-func newSessionRepo(lc fx.Lifecycle, cfg *conf) (db.SessionRepo, error) {
+//newAdminRouter serves admin API on a separate address. All the requests require admin token
+func newAdminRouter(lc fx.Lifecycle, cfg *conf) *adminRouter {
+	mux := chi.NewRouter()
+	mux.Use(admin.Auth(cfg.AdminToken))
+
+	server := &http.Server{
+		Addr:    cfg.AdminAddr,
+		Handler: mux,
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if "" == cfg.AdminToken {
+				log.Warn("ADMIN_TOKEN isn't set. Admin API is disabled")
+			}
+			log.Infof("Starting admin HTTP server on %s", cfg.AdminAddr)
+
+			go server.ListenAndServe()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			log.Info("Stopping admin HTTP server.")
+			return server.Shutdown(ctx)
+		},
+	})
+	return &adminRouter{Router: mux}
+}
+
+//newStormDB opens Bolt DB. It's opened regardless of DB driver since results for export and RP reporting queue
+//are always kept in Bolt, so DB_FILE must be on a persistent volume of each bot instance even if redis is used
+func newStormDB(lc fx.Lifecycle, cfg *conf) (*storm.DB, error) {
 	bdb, err := storm.Open(cfg.DbFile, storm.BoltOptions(0600, &bolt.Options{}))
 	if err != nil {
 		log.WithError(err).Error("Cannot open DB")
 		return nil, err
 	}
+	if "bolt" != cfg.DbDriver {
+		log.Infof("Results and RP reporting queue are kept in local DB file %s", cfg.DbFile)
+	}
 	lc.Append(fx.Hook{
 		OnStop: func(ctx context.Context) error {
 			return bdb.Close()
 		},
 	})
+	return bdb, nil
+}
+
+//newRedisClient connects to Redis if it's used as DB driver. Otherwise returns nil
+func newRedisClient(lc fx.Lifecycle, cfg *conf) (*redis.Client, error) {
+	if "redis" != cfg.DbDriver {
+		return nil, nil
+	}
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if nil != err {
+		return nil, errors.Wrap(err, "incorrect Redis URL")
+	}
+	client := redis.NewClient(opts)
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return client.Close()
+		},
+	})
+	return client, nil
+}
 
-	return db.NewStormSessionRepo(bdb)
+func newSessionRepo(cfg *conf, bdb *storm.DB, client *redis.Client, checks *health.Registry) (db.SessionRepo, error) {
+	var repo db.SessionRepo
+	switch cfg.DbDriver {
+	case "bolt":
+		stormRepo, err := db.NewStormSessionRepo(bdb)
+		if nil != err {
+			return nil, err
+		}
+		checks.Register("db", health.CheckerFunc(stormRepo.Ping))
+		repo = stormRepo
+	case "redis":
+		redisRepo := db.NewRedisSessionRepo(client, cfg.SessionTTL)
+		checks.Register("db", health.CheckerFunc(redisRepo.Ping))
+		repo = redisRepo
+	case "memory":
+		log.Warn("Sessions are kept in memory and will be lost on restart")
+		memoryRepo := db.NewMemorySessionRepo()
+		checks.Register("db", health.CheckerFunc(memoryRepo.Ping))
+		repo = memoryRepo
+	default:
+		return nil, errors.Errorf("unknown DB driver '%s'", cfg.DbDriver)
+	}
+	return db.NewTracedSessionRepo(repo), nil
 }
 
-func newIntentDispatcher(nlp *nlp.IntentParser, repo db.SessionRepo, rp *rp.Reporter) *bot.Dispatcher {
+//newUpdateLog keeps update offsets in the same storage as sessions
+func newUpdateLog(cfg *conf, bdb *storm.DB, client *redis.Client) (db.UpdateLog, error) {
+	switch cfg.DbDriver {
+	case "bolt":
+		return db.NewStormUpdateLog(bdb)
+	case "redis":
+		return db.NewRedisUpdateLog(client), nil
+	default:
+		return db.NewMemoryUpdateLog(), nil
+	}
+}
+
+//newCallbackSigner signs buttons with CALLBACK_SECRET. If it isn't set, key generated on the first start is kept
+//in Bolt DB, so buttons stay valid after restart
+func newCallbackSigner(cfg *conf, bdb *storm.DB) (*bot.CallbackSigner, error) {
+	if "" != cfg.CallbackSecret {
+		return bot.NewCallbackSigner([]byte(cfg.CallbackSecret))
+	}
+	if "bolt" != cfg.DbDriver {
+		log.Warn("Callback secret isn't set. Each instance signs buttons with its own key, so they must not share sessions")
+	}
+	key, err := db.LoadSecret(bdb, "callback", 32)
+	if nil != err {
+		return nil, errors.Wrap(err, "cannot load callback key")
+	}
+	return bot.NewCallbackSigner(key)
+}
+
+func newFlowDispatcher(repo db.SessionRepo, reporter reporting.ResultReporter, signer *bot.CallbackSigner) *bot.FlowDispatcher {
+	return bot.NewFlowDispatcher(repo, bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
+		return bot.Respond(bot.NewResponse().WithText("What...??? I don't know how to handle that!")), nil
+	}), intents.NewQuizFlow(repo, reporter, signer))
+}
+
+func newIntentDispatcher(cfg *conf, nlp *nlp.IntentParser, repo db.SessionRepo, flows *bot.FlowDispatcher) *bot.Dispatcher {
 	d := &bot.Dispatcher{
-		NLP: nlp,
-		Handler: bot.IntentNameDispatcher(map[string]bot.Handler{
-			"exit.intent":  intents.NewExitQuizHandler(repo, rp),
-			"start.intent": intents.NewStartQuizHandler(repo, rp),
-		}, intents.NewQuizIntentHandler(repo, rp), bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
-			return bot.Respond(bot.NewResponse().WithText("What...??? I don't know how to handle that!")), nil
-		})),
+		NLP:         metrics.NewIntentParser(nlp),
+		StartIntent: intents.StartIntent,
+		Handler:     flows,
 		ErrHandler: bot.ErrorHandlerFunc(func(ctx context.Context, err error) []*bot.Response {
-			logErr(err)
+			logErr(ctx, err)
 			return bot.Respond(bot.NewResponse().WithText(fmt.Sprintf("Sorry, error has occured: %s", err)))
 		}),
 	}
@@ -133,59 +326,191 @@ func newIntentDispatcher(nlp *nlp.IntentParser, repo db.SessionRepo, rp *rp.Repo
 			if "" == sessionID {
 				return nil, errors.Errorf("User ID isn't recognized")
 			}
-			session, err := loadSession(repo, sessionID)
+			event := cfg.EventName
+			session, err := loadSession(ctx, repo, sessionID)
 			if nil == err && nil != session {
 				ctx = botctx.WithSession(ctx, session)
+				//quiz may be started at the event from the deep link
+				if "" != session.Event {
+					event = session.Event
+				}
+			}
+			if "" == botctx.GetEvent(ctx) {
+				ctx = botctx.WithEvent(ctx, event)
 			}
 			return next.Handle(ctx, rq)
 		})
 	})
+	d.Use(bot.RequestLogging)
+	d.Use(metrics.Middleware)
 
 	return d
 }
 
-func newIntentParser(cfg *conf) *nlp.IntentParser {
-	return nlp.NewIntentParser(cfg.NlpURL)
+//initSessionSweeper times out sessions of the users who walked away in the middle of the quiz
+func initSessionSweeper(lc fx.Lifecycle, cfg *conf, repo db.SessionRepo, flows *bot.FlowDispatcher, dispatcher *bot.Dispatcher) {
+	sweeper := bot.NewSessionSweeper(repo, flows, dispatcher, cfg.SessionSweepInterval)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			sweeper.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return sweeper.Stop(ctx)
+		},
+	})
+}
+
+func newIntentParser(cfg *conf, checks *health.Registry) *nlp.IntentParser {
+	parser := nlp.NewIntentParser(cfg.NlpURL)
+	checks.Register("nlp", health.CheckerFunc(parser.Ping))
+	return parser
 }
 
-func newRPReporter(cfg *conf) *rp.Reporter {
-	return rp.NewReporter(gorp.NewClient(cfg.RpHost, cfg.RpProject, cfg.RpUUID))
+func newResultStore(cfg *conf, bdb *storm.DB) (reporting.ResultStore, error) {
+	store, err := reporting.NewStormResultStore(bdb)
+	if nil != err {
+		return nil, err
+	}
+	store.Retention = reporting.Retention{TTL: cfg.ResultsTTL, Max: cfg.ResultsMax}
+	return store, nil
 }
 
-func newTelegramBot(lc fx.Lifecycle, cfg *conf, dispatcher *bot.Dispatcher) *telegram.Bot {
+//newResultReporter creates reporters configured in REPORTERS. Metrics are always collected
+func newResultReporter(lc fx.Lifecycle, cfg *conf, bdb *storm.DB, results reporting.ResultStore, checks *health.Registry, adminMux *adminRouter) (reporting.ResultReporter, error) {
+	reporters := []reporting.ResultReporter{metrics.NewResultReporter()}
+	for _, name := range cfg.Reporters {
+		switch strings.TrimSpace(name) {
+		case "rp":
+			reporter, err := newRPReporter(lc, cfg, bdb, checks, adminMux)
+			if nil != err {
+				return nil, err
+			}
+			defects, err := newRPDefects(cfg)
+			if nil != err {
+				return nil, err
+			}
+			quizReporter := rp.NewQuizReporter(reporter)
+			quizReporter.Defects = defects
+			quizReporter.SharedLaunch = "event" == cfg.RpLaunchMode
+			quizReporter.ReportRemaining = cfg.RpReportSkipped
+			reporters = append(reporters, quizReporter)
+		case "file":
+			reporter, err := reporting.NewFileReporter(cfg.ReportFile)
+			if nil != err {
+				return nil, errors.Wrap(err, "cannot open report file")
+			}
+			lc.Append(fx.Hook{
+				OnStop: func(ctx context.Context) error {
+					return reporter.Close()
+				},
+			})
+			reporters = append(reporters, reporter)
+		case "junit":
+			reporters = append(reporters, reporting.NewJUnitReporter(results, cfg.JUnitDir))
+		case "none", "":
+		default:
+			return nil, errors.Errorf("unknown reporter '%s'", name)
+		}
+	}
+	return reporting.NewFanOut(reporters...), nil
+}
+
+//newRPDefects parses defect classification and validates it against issue types of the RP project.
+//Knowledge Gap type wrong answers are classified with by default is created if project doesn't have it
+func newRPDefects(cfg *conf) (*rp.Defects, error) {
+	defects, err := rp.ParseDefects(cfg.RpDefects)
+	if nil != err {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	types, err := rp.FetchIssueTypes(ctx, cfg.RpHost, cfg.RpProject, cfg.RpUUID)
+	if nil != err {
+		return nil, errors.Wrap(err, "cannot fetch RP issue types to validate defect classification")
+	}
+	if "" == defects.WrongAnswer {
+		if defects.WrongAnswer, err = rp.EnsureKnowledgeGap(ctx, cfg.RpHost, cfg.RpProject, cfg.RpUUID, types); nil != err {
+			return nil, errors.Wrap(err, "cannot resolve issue type of wrong answers. Set it in RP_DEFECTS")
+		}
+	}
+	if err := defects.Validate(types); nil != err {
+		return nil, err
+	}
+	return defects, nil
+}
+
+//newRPReporter creates RP reporter. Shared launches stay in progress across restarts until they are finished with admin API
+func newRPReporter(lc fx.Lifecycle, cfg *conf, bdb *storm.DB, checks *health.Registry, adminMux *adminRouter) (*rp.Reporter, error) {
+	if "" == cfg.RpUUID || "" == cfg.RpProject {
+		return nil, errors.New("RP_UUID and RP_PROJECT are required by rp reporter")
+	}
+	store, err := rp.NewStormQueueStore(bdb)
+	if nil != err {
+		return nil, err
+	}
+	checks.Register("rp", rp.NewPinger(cfg.RpHost, cfg.RpProject, cfg.RpUUID))
+
+	reporter := rp.NewReporter(metrics.NewRPClient(rp.NewClient(cfg.RpHost, cfg.RpProject, cfg.RpUUID)), store)
+	adminMux.Post("/api/v1/rp/launches/finish", rp.FinishLaunchesHandler(reporter))
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return reporter.Resume()
+		},
+		OnStop: func(ctx context.Context) error {
+			return reporter.Stop(ctx)
+		},
+	})
+	return reporter, nil
+}
+
+func newTelegramBot(lc fx.Lifecycle, cfg *conf, dispatcher *bot.Dispatcher, updates db.UpdateLog, repo db.SessionRepo, checks *health.Registry) *telegram.Bot {
 	tBot := &telegram.Bot{
 		Token:      cfg.TelegramToken,
 		Dispatcher: dispatcher,
+		Workers:    cfg.TelegramWorkers,
+		Updates:    updates,
+
+		RateLimit:     cfg.TelegramRateLimit,
+		ChatRateLimit: cfg.TelegramChatRateLimit,
+		ChatBurst:     cfg.TelegramChatBurst,
+
+		QuizPolls:      cfg.TelegramQuizPolls,
+		PollOpenPeriod: cfg.TelegramPollOpenPeriod,
+		Sessions:       repo,
 	}
+	checks.Register("telegram", tBot)
 	lc.Append(fx.Hook{
 		OnStart: func(ctc context.Context) error {
 			return tBot.Start()
 		},
+		OnStop: func(ctx context.Context) error {
+			return tBot.Stop(ctx)
+		},
 	})
 	return tBot
 }
 
-func register(mux chi.Router, bot *telegram.Bot) {
-	mux.Get("/health", func(w http.ResponseWriter, rq *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		if _, err := w.Write([]byte(`{"status" : "ok"}`)); nil != err {
-			log.WithError(err).Error("health check response error")
-		}
-		w.WriteHeader(http.StatusOK)
-	})
+func register(mux chi.Router, adminMux *adminRouter, checks *health.Registry, results reporting.ResultStore, bot *telegram.Bot) {
+	mux.Get("/health/live", health.LiveHandler())
+	mux.Get("/health/ready", checks.ReadyHandler())
+	mux.Handle("/metrics", metrics.Handler())
+	//results expose user names and answers, so they are exported on admin address only
+	adminMux.Get("/api/v1/results/junit", reporting.JUnitHandler(results))
 }
 
-func logErr(err error) {
+func logErr(ctx context.Context, err error) {
 	if err != nil {
-		if err, ok := err.(stackTracer); ok {
-			stackTrace := make([]string, len(err.StackTrace()))
-			for i, f := range err.StackTrace() {
+		logger := tracing.Logger(ctx).WithError(err)
+		if st, ok := err.(stackTracer); ok {
+			stackTrace := make([]string, len(st.StackTrace()))
+			for i, f := range st.StackTrace() {
 				stackTrace[i] = fmt.Sprintf("%+v", f)
 			}
-			fmt.Println(strings.Join(stackTrace, "\n"))
-		} else {
-			log.Errorf("%s", err)
+			logger = logger.WithField("stacktrace", strings.Join(stackTrace, "\n"))
 		}
+		logger.Error("Request handling error")
 	}
 }
 
@@ -194,9 +519,9 @@ type stackTracer interface {
 	StackTrace() errors.StackTrace
 }
 
-func loadSession(repo db.SessionRepo, id string) (*db.QuizSession, error) {
+func loadSession(ctx context.Context, repo db.SessionRepo, id string) (*db.QuizSession, error) {
 	var session db.QuizSession
-	err := repo.Load(id, &session)
+	err := repo.Load(ctx, id, &session)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,142 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "rpquiz"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	//UpdatesReceived counts updates received from messaging channels
+	UpdatesReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_received_total",
+		Help:      "Updates received per channel",
+	}, []string{"channel"})
+
+	//IntentsRecognized counts recognized intents by name and confidence bucket
+	IntentsRecognized = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "intents_recognized_total",
+		Help:      "Intents recognized by name and confidence bucket",
+	}, []string{"intent", "confidence"})
+
+	//HandlerDuration measures latency of request handling
+	HandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Latency of request handling",
+	}, []string{"request"})
+
+	//HandlerErrors counts failed requests
+	HandlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_errors_total",
+		Help:      "Requests handling of which has failed",
+	}, []string{"request"})
+
+	//Quizzes counts quizzes by outcome: started, finished or aborted
+	Quizzes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quizzes_total",
+		Help:      "Quizzes started, finished and aborted",
+	}, []string{"outcome"})
+
+	//Answers counts answers by question, its category and correctness. Question is identified by a short hash of its
+	//text, so number of series is bounded by the size of the question bank
+	Answers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "answers_total",
+		Help:      "Answers per question (8 hex digits of SHA-256 of the question text), its category and correctness",
+	}, []string{"category", "question", "correct"})
+
+	//NLPDuration measures latency of NLP service calls
+	NLPDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "nlp_duration_seconds",
+		Help:      "Latency of NLP service calls",
+	})
+
+	//NLPFailures counts failed NLP service calls
+	NLPFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nlp_failures_total",
+		Help:      "Failed NLP service calls",
+	})
+
+	//RPCalls counts ReportPortal calls by operation and outcome
+	RPCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rp_calls_total",
+		Help:      "ReportPortal calls by operation and outcome",
+	}, []string{"operation", "outcome"})
+
+	//MessagesSent counts outbound messages by channel and outcome: sent, failed or dropped
+	MessagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Outbound messages by channel and outcome",
+	}, []string{"channel", "outcome"})
+
+	//MessagesRetried counts retries of outbound messages by channel and reason: rate_limited or error
+	MessagesRetried = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_retried_total",
+		Help:      "Retries of outbound messages by channel and reason",
+	}, []string{"channel", "reason"})
+
+	//MessagesQueued is a number of outbound messages waiting to be sent
+	MessagesQueued = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "messages_queued",
+		Help:      "Outbound messages waiting to be sent",
+	}, []string{"channel"})
+)
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		UpdatesReceived,
+		IntentsRecognized,
+		HandlerDuration,
+		HandlerErrors,
+		Quizzes,
+		Answers,
+		NLPDuration,
+		NLPFailures,
+		RPCalls,
+		MessagesSent,
+		MessagesRetried,
+		MessagesQueued,
+	)
+}
+
+//Handler exposes collected metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+//Outcome converts error to the outcome label value
+func Outcome(err error) string {
+	if nil != err {
+		return "error"
+	}
+	return "success"
+}
+
+//confidenceBucket converts intent confidence to the label value
+func confidenceBucket(conf float64) string {
+	switch {
+	case conf < 0.5:
+		return "low"
+	case conf < 0.8:
+		return "medium"
+	default:
+		return "high"
+	}
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"time"
+)
+
+//Middleware is a dispatcher middleware measuring handlers latency, errors and recognized intents
+func Middleware(next bot.Handler) bot.Handler {
+	return bot.HandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
+		request := "callback"
+		if irq, ok := rq.(*bot.IntentRequest); ok {
+			request = irq.Intent
+			IntentsRecognized.WithLabelValues(irq.Intent, confidenceBucket(irq.Confidence)).Inc()
+		}
+
+		start := time.Now()
+		rss, err := next.Handle(ctx, rq)
+		HandlerDuration.WithLabelValues(request).Observe(time.Since(start).Seconds())
+		if nil != err {
+			HandlerErrors.WithLabelValues(request).Inc()
+		}
+		return rss, err
+	})
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	failing := Middleware(bot.NewHandlerFunc(func(ctx context.Context, rq bot.Request) ([]*bot.Response, error) {
+		return nil, errors.New("failed")
+	}))
+	errorsBefore := testutil.ToFloat64(HandlerErrors.WithLabelValues("start.intent"))
+	intentsBefore := testutil.ToFloat64(IntentsRecognized.WithLabelValues("start.intent", "medium"))
+	callbacksBefore := testutil.ToFloat64(HandlerErrors.WithLabelValues("callback"))
+
+	if _, err := failing.Handle(context.Background(), &bot.IntentRequest{Intent: "start.intent", Confidence: 0.6}); nil == err {
+		t.Error("Expected error to be passed through")
+	}
+	failing.Handle(context.Background(), &bot.CallbackRequest{Raw: "1"})
+
+	if delta := testutil.ToFloat64(HandlerErrors.WithLabelValues("start.intent")) - errorsBefore; 1 != delta {
+		t.Errorf("Expected intent error to be counted, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(HandlerErrors.WithLabelValues("callback")) - callbacksBefore; 1 != delta {
+		t.Errorf("Expected callback error to be counted, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(IntentsRecognized.WithLabelValues("start.intent", "medium")) - intentsBefore; 1 != delta {
+		t.Errorf("Expected intent to be counted in medium confidence bucket, got %v", delta)
+	}
+}
+
+func TestConfidenceBucket(t *testing.T) {
+	for conf, exp := range map[float64]string{0.1: "low", 0.5: "medium", 0.79: "medium", 0.8: "high", 1: "high"} {
+		if bucket := confidenceBucket(conf); exp != bucket {
+			t.Errorf("Confidence %v: expected bucket %s, got %s", conf, exp, bucket)
+		}
+	}
+}
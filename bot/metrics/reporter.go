@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//ResultReporter counts quizzes and answers
+type ResultReporter struct{}
+
+//NewResultReporter creates new instance of ResultReporter
+func NewResultReporter() *ResultReporter {
+	return &ResultReporter{}
+}
+
+//QuizStarted counts started quiz
+func (r *ResultReporter) QuizStarted(ctx context.Context, s *db.QuizSession) {
+	Quizzes.WithLabelValues("started").Inc()
+}
+
+// QuestionAsked does nothing
+func (r *ResultReporter) QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string) {
+}
+
+//QuestionAnswered counts answer to the question
+func (r *ResultReporter) QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool) {
+	Answers.WithLabelValues(categoryOf(s.Questions[q]), questionKey(s.Questions[q]), strconv.FormatBool(passed)).Inc()
+}
+
+//questionKey identifies question in the metrics. Question texts are long and may contain anything,
+//so short hash of the text is used instead
+func questionKey(q *opentdb.Question) string {
+	text, err := url.PathUnescape(q.Question)
+	if nil != err {
+		text = q.Question
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(text)))
+	return hex.EncodeToString(sum[:4])
+}
+
+//QuizFinished counts finished quiz
+func (r *ResultReporter) QuizFinished(ctx context.Context, s *db.QuizSession) {
+	Quizzes.WithLabelValues("finished").Inc()
+}
+
+//QuizAborted counts aborted quiz
+func (r *ResultReporter) QuizAborted(ctx context.Context, s *db.QuizSession, reason string) {
+	Quizzes.WithLabelValues("aborted").Inc()
+}
+
+//categoryOf converts category of the question to the label value
+func categoryOf(q *opentdb.Question) string {
+	category, err := url.PathUnescape(q.Category)
+	if nil != err {
+		category = q.Category
+	}
+	if category = strings.TrimSpace(category); "" == category {
+		return "uncategorized"
+	}
+	return category
+}
@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestAnswersCountedPerQuestion(t *testing.T) {
+	s := &db.QuizSession{Questions: []*opentdb.Question{
+		{Category: "Science%3A%20Computers", Question: "What%20is%20RP%3F"},
+		{Category: "Science: Computers", Question: "What is RP?"},
+		{Category: "Science: Computers", Question: "Another question"},
+		{Question: "Question without category"},
+	}}
+	rp := Answers.WithLabelValues("Science: Computers", questionKey(s.Questions[1]), "true")
+	another := Answers.WithLabelValues("Science: Computers", questionKey(s.Questions[2]), "true")
+	uncategorized := Answers.WithLabelValues("uncategorized", questionKey(s.Questions[3]), "false")
+	before, beforeAnother, beforeUncategorized := testutil.ToFloat64(rp), testutil.ToFloat64(another), testutil.ToFloat64(uncategorized)
+
+	r := NewResultReporter()
+	r.QuestionAnswered(context.Background(), s, 0, "", true)
+	r.QuestionAnswered(context.Background(), s, 1, "", true)
+	r.QuestionAnswered(context.Background(), s, 2, "", true)
+	r.QuestionAnswered(context.Background(), s, 3, "", false)
+
+	if delta := testutil.ToFloat64(rp) - before; 2 != delta {
+		t.Errorf("Expected 2 correct answers of escaped and plain question, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(another) - beforeAnother; 1 != delta {
+		t.Errorf("Expected 1 correct answer of another question, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(uncategorized) - beforeUncategorized; 1 != delta {
+		t.Errorf("Expected 1 wrong answer without category, got %v", delta)
+	}
+}
+
+func TestQuestionKey(t *testing.T) {
+	key := questionKey(&opentdb.Question{Question: "What is RP?"})
+	if 8 != len(key) {
+		t.Errorf("Expected 8 hex digits, got %s", key)
+	}
+	if key == questionKey(&opentdb.Question{Question: "What is TMS?"}) {
+		t.Error("Expected questions to have different keys")
+	}
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"github.com/avarabyeu/rpquiz/bot/nlp"
+	"github.com/avarabyeu/rpquiz/bot/rp"
+	"time"
+)
+
+type (
+	intentParser struct {
+		parser bot.IntentParser
+	}
+
+	rpClient struct {
+		client rp.Client
+	}
+)
+
+//NewIntentParser wraps intent parser to measure NLP service latency and failures
+func NewIntentParser(parser bot.IntentParser) bot.IntentParser {
+	return &intentParser{parser: parser}
+}
+
+//NewRPClient wraps ReportPortal client used by reporter to count calls outcome
+func NewRPClient(client rp.Client) rp.Client {
+	return &rpClient{client: client}
+}
+
+//Parse parses intent based natural language
+func (p *intentParser) Parse(ctx context.Context, q string) (*nlp.Intent, error) {
+	start := time.Now()
+	intent, err := p.parser.Parse(ctx, q)
+	NLPDuration.Observe(time.Since(start).Seconds())
+	if nil != err {
+		NLPFailures.Inc()
+	}
+	return intent, err
+}
+
+func (c *rpClient) StartLaunch(rq *rp.StartLaunchRQ) (*rp.EntryCreatedRS, error) {
+	rs, err := c.client.StartLaunch(rq)
+	RPCalls.WithLabelValues("start_launch", Outcome(err)).Inc()
+	return rs, err
+}
+
+func (c *rpClient) FinishLaunch(id string, rq *rp.FinishExecutionRQ) (*rp.FinishLaunchRS, error) {
+	rs, err := c.client.FinishLaunch(id, rq)
+	RPCalls.WithLabelValues("finish_launch", Outcome(err)).Inc()
+	return rs, err
+}
+
+func (c *rpClient) StopLaunch(id string) (*rp.MsgRS, error) {
+	rs, err := c.client.StopLaunch(id)
+	RPCalls.WithLabelValues("stop_launch", Outcome(err)).Inc()
+	return rs, err
+}
+
+func (c *rpClient) StartTest(rq *rp.StartTestRQ) (*rp.EntryCreatedRS, error) {
+	rs, err := c.client.StartTest(rq)
+	RPCalls.WithLabelValues("start_test", Outcome(err)).Inc()
+	return rs, err
+}
+
+func (c *rpClient) StartChildTest(parent string, rq *rp.StartTestRQ) (*rp.EntryCreatedRS, error) {
+	rs, err := c.client.StartChildTest(parent, rq)
+	RPCalls.WithLabelValues("start_child_test", Outcome(err)).Inc()
+	return rs, err
+}
+
+func (c *rpClient) SaveLog(rq *rp.SaveLogRQ) (*rp.EntryCreatedRS, error) {
+	rs, err := c.client.SaveLog(rq)
+	RPCalls.WithLabelValues("save_log", Outcome(err)).Inc()
+	return rs, err
+}
+
+func (c *rpClient) FinishTest(id string, rq *rp.FinishTestRQ) (*rp.MsgRS, error) {
+	rs, err := c.client.FinishTest(id, rq)
+	RPCalls.WithLabelValues("finish_test", Outcome(err)).Inc()
+	return rs, err
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/avarabyeu/rpquiz/bot/nlp"
+	"github.com/avarabyeu/rpquiz/bot/rp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+type (
+	fakeParser struct {
+		err error
+	}
+
+	//fakeRPClient implements StartLaunch only, other calls aren't expected
+	fakeRPClient struct {
+		rp.Client
+		err error
+	}
+)
+
+func (p *fakeParser) Parse(ctx context.Context, q string) (*nlp.Intent, error) {
+	return &nlp.Intent{Name: q}, p.err
+}
+
+func (c *fakeRPClient) StartLaunch(rq *rp.StartLaunchRQ) (*rp.EntryCreatedRS, error) {
+	return &rp.EntryCreatedRS{}, c.err
+}
+
+func TestIntentParserCountsFailures(t *testing.T) {
+	before := testutil.ToFloat64(NLPFailures)
+
+	if _, err := NewIntentParser(&fakeParser{}).Parse(context.Background(), "hi"); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := NewIntentParser(&fakeParser{err: errors.New("unavailable")}).Parse(context.Background(), "hi"); nil == err {
+		t.Error("Expected error to be passed through")
+	}
+
+	if delta := testutil.ToFloat64(NLPFailures) - before; 1 != delta {
+		t.Errorf("Expected 1 failure to be counted, got %v", delta)
+	}
+}
+
+func TestRPClientCountsOutcome(t *testing.T) {
+	success := RPCalls.WithLabelValues("start_launch", "success")
+	failure := RPCalls.WithLabelValues("start_launch", "error")
+	successBefore, failureBefore := testutil.ToFloat64(success), testutil.ToFloat64(failure)
+
+	NewRPClient(&fakeRPClient{}).StartLaunch(&rp.StartLaunchRQ{})
+	NewRPClient(&fakeRPClient{err: errors.New("unavailable")}).StartLaunch(&rp.StartLaunchRQ{})
+
+	if delta := testutil.ToFloat64(success) - successBefore; 1 != delta {
+		t.Errorf("Expected 1 successful call, got %v", delta)
+	}
+	if delta := testutil.ToFloat64(failure) - failureBefore; 1 != delta {
+		t.Errorf("Expected 1 failed call, got %v", delta)
+	}
+}
@@ -1,7 +1,9 @@
 package nlp
 
 import (
-	"github.com/apex/log"
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"github.com/pkg/errors"
 	"gopkg.in/resty.v1"
 	"net/http"
 )
@@ -30,11 +32,28 @@ func NewIntentParser(url string) *IntentParser {
 }
 
 //Parse parses intent based natural language
-func (n *IntentParser) Parse(q string) *Intent {
+func (n *IntentParser) Parse(ctx context.Context, q string) (*Intent, error) {
+	ctx, span := tracing.StartSpan(ctx, "nlp.Parse")
+
 	var rs Intent
-	resp, err := n.s.NewRequest().SetBody(map[string]string{"q": q}).SetResult(&rs).Post("")
-	if nil != err || nil == &rs {
-		log.Errorf("Error executing request. Status code: %d. %s", resp.StatusCode(), err)
+	resp, err := n.s.NewRequest().SetContext(ctx).SetBody(map[string]string{"q": q}).SetResult(&rs).Post("")
+	if nil == err && resp.IsError() {
+		err = errors.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+	tracing.EndSpan(span, err)
+	if nil != err {
+		return nil, err
+	}
+
+	tracing.Logger(ctx).Debugf("Intent parsed: %s [%f]", rs.Name, rs.Conf)
+	return &rs, nil
+}
+
+//Ping makes sure NLP service is up and responding
+func (n *IntentParser) Ping(ctx context.Context) error {
+	resp, err := n.s.NewRequest().SetContext(ctx).Get("/health")
+	if nil == err && resp.IsError() {
+		err = errors.Errorf("unexpected status code: %d", resp.StatusCode())
 	}
-	return &rs
+	return err
 }
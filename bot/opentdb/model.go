@@ -1,6 +1,7 @@
 package opentdb
 
 import (
+	"github.com/apex/log"
 	"gopkg.in/resty.v1"
 	"strconv"
 	"io/ioutil"
@@ -8,6 +9,9 @@ import (
 	"os"
 	"math/rand"
 	"time"
+	"path/filepath"
+	"strings"
+	"unicode"
 )
 
 const openTdbURL = "https://opentdb.com"
@@ -26,6 +30,17 @@ type (
 		Question         string   `json:"question,omitempty"`
 		CorrectAnswer    string   `json:"correct_answer,omitempty"`
 		IncorrectAnswers []string `json:"incorrect_answers,omitempty"`
+
+		//Image is an URL, data URI or path to the image shown with the question. Relative paths are resolved against questions file
+		Image string `json:"image,omitempty"`
+		//Code is a snippet shown with the question
+		Code string `json:"code,omitempty"`
+		//CodeLanguage is a programming language of the snippet
+		CodeLanguage string `json:"code_language,omitempty"`
+		//Document is an URL, data URI or path to the file attached to the question
+		Document string `json:"document,omitempty"`
+		//Explanation is shown once question is answered if channel supports it
+		Explanation string `json:"explanation,omitempty"`
 	}
 
 	//Client is the OpenTDB client
@@ -55,6 +70,13 @@ func (c Client) GetQuestions(count int) ([]*Question, error) {
 
 //GetPredefinedQuestions get number of random questions
 func GetPredefinedQuestions(count int) ([]*Question, error) {
+	return GetQuizQuestions(count, "")
+}
+
+//GetQuizQuestions gets number of random questions of the named quiz. Quiz is a question category,
+//name is compared ignoring case, spaces and punctuation, e.g. "data-base" matches "Data base".
+//Empty name means questions of all categories
+func GetQuizQuestions(count int, quiz string) ([]*Question, error) {
 	var res response
 	dir := os.Getenv("QUESTION_FILE")
 	jsonFile, err := os.Open(dir)
@@ -66,7 +88,57 @@ func GetPredefinedQuestions(count int) ([]*Question, error) {
 	byteValue, err := ioutil.ReadAll(jsonFile)
 	json.Unmarshal(byteValue, &res)
 
+	questions := res.Results[:0]
+	for _, q := range res.Results {
+		if "" != quiz && QuizName(q.Category) != QuizName(quiz) {
+			continue
+		}
+		q.Image = resolve(filepath.Dir(dir), q.Image)
+		q.Document = resolve(filepath.Dir(dir), q.Document)
+		if missing := missingFile(q.Image, q.Document); "" != missing {
+			//question would be sent without attachment it refers to
+			log.Warnf("Question '%s' is skipped since its attachment %s isn't found", q.Question, missing)
+			continue
+		}
+		questions = append(questions, q)
+	}
+	res.Results = questions
+	if count > len(res.Results) {
+		count = len(res.Results)
+	}
+
 	rand.Seed(time.Now().UnixNano())
 	rand.Shuffle(len(res.Results), func(i, j int) { res.Results[i], res.Results[j] = res.Results[j], res.Results[i] })
 	return res.Results[:count], err
 }
+
+//QuizName normalizes name of the quiz: lower-cased letters and digits only
+func QuizName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+//missingFile returns the first local file of the sources which doesn't exist. URLs and data URIs aren't checked
+func missingFile(sources ...string) string {
+	for _, source := range sources {
+		if "" == source || strings.Contains(source, ":") {
+			continue
+		}
+		if _, err := os.Stat(source); nil != err {
+			return source
+		}
+	}
+	return ""
+}
+
+//resolve makes relative path to the local file relative to the given directory. URLs are kept as is
+func resolve(dir, source string) string {
+	if "" == source || strings.Contains(source, ":") || filepath.IsAbs(source) {
+		return source
+	}
+	return filepath.Join(dir, source)
+}
@@ -0,0 +1,60 @@
+package opentdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetQuizQuestions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpquiz")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "assets"), 0755); nil != err {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "assets", "w1.png"), []byte("png"), 0644); nil != err {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "questions.json")
+	err = ioutil.WriteFile(file, []byte(`{"results": [
+		{"category": " Widgets", "question": "w1", "image": "assets/w1.png"},
+		{"category": "Widgets", "question": "w2", "document": "assets/missing.xml"},
+		{"category": "Data base", "question": "d1"},
+		{"category": "Data base", "question": "d2", "image": "https://rp.io/d2.png"}
+	]}`), 0644)
+	if nil != err {
+		t.Fatal(err)
+	}
+	os.Setenv("QUESTION_FILE", file)
+	defer os.Unsetenv("QUESTION_FILE")
+
+	for _, c := range []struct {
+		quiz  string
+		count int
+		exp   int
+	}{
+		{"", 2, 2},
+		{"data-base", 5, 2},
+		{"WIDGETS", 5, 1},
+		{"unknown", 5, 0},
+	} {
+		questions, err := GetQuizQuestions(c.count, c.quiz)
+		if nil != err {
+			t.Fatal(err)
+		}
+		if c.exp != len(questions) {
+			t.Errorf("%s: expected %d questions, got %d", c.quiz, c.exp, len(questions))
+		}
+	}
+
+	questions, _ := GetQuizQuestions(1, "widgets")
+	if exp := filepath.Join(dir, "assets", "w1.png"); exp != questions[0].Image {
+		t.Errorf("Expected image path to be resolved to %s, got %s", exp, questions[0].Image)
+	}
+}
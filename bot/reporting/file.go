@@ -0,0 +1,142 @@
+package reporting
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	//FileReporter appends quiz events to the file in JSON-lines format
+	FileReporter struct {
+		mu   sync.Mutex
+		file *os.File
+	}
+
+	//Record is a single line of the results file
+	Record struct {
+		Time         time.Time `json:"time"`
+		Type         string    `json:"type"`
+		SessionID    string    `json:"session_id"`
+		User         string    `json:"user,omitempty"`
+		Channel      string    `json:"channel,omitempty"`
+		Event        string    `json:"event,omitempty"`
+		Quiz         string    `json:"quiz,omitempty"`
+		Referral     string    `json:"referral,omitempty"`
+		Question     string    `json:"question,omitempty"`
+		Category     string    `json:"category,omitempty"`
+		Difficulty   string    `json:"difficulty,omitempty"`
+		Options      []string  `json:"options,omitempty"`
+		Answer       string    `json:"answer,omitempty"`
+		Correct      string    `json:"correct_answer,omitempty"`
+		Passed       *bool     `json:"passed,omitempty"`
+		ResponseTime float64   `json:"response_time,omitempty"`
+		Score        *int      `json:"score,omitempty"`
+		Total        int       `json:"total,omitempty"`
+		Reason       string    `json:"reason,omitempty"`
+	}
+)
+
+//NewFileReporter opens the file for appending and creates new instance of FileReporter
+func NewFileReporter(path string) (*FileReporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if nil != err {
+		return nil, err
+	}
+	return &FileReporter{file: f}, nil
+}
+
+//QuizStarted writes quiz start record
+func (r *FileReporter) QuizStarted(ctx context.Context, s *db.QuizSession) {
+	r.write(ctx, r.record(ctx, "quiz_started", s))
+}
+
+//QuestionAsked writes question record
+func (r *FileReporter) QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string) {
+	rec := r.question(ctx, "question_asked", s, q)
+	rec.Options = options
+	r.write(ctx, rec)
+}
+
+//QuestionAnswered writes answer record
+func (r *FileReporter) QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool) {
+	rec := r.question(ctx, "question_answered", s, q)
+	rec.Answer = answer
+	rec.Correct, _ = url.PathUnescape(s.Questions[q].CorrectAnswer)
+	rec.Correct = strings.TrimSpace(rec.Correct)
+	rec.Passed = &passed
+	if !s.QuestionAskedAt.IsZero() {
+		rec.ResponseTime = time.Since(s.QuestionAskedAt).Seconds()
+	}
+	r.write(ctx, rec)
+}
+
+//QuizFinished writes quiz finish record with the score
+func (r *FileReporter) QuizFinished(ctx context.Context, s *db.QuizSession) {
+	r.write(ctx, r.result(ctx, "quiz_finished", s))
+}
+
+//QuizAborted writes quiz abort record with the score
+func (r *FileReporter) QuizAborted(ctx context.Context, s *db.QuizSession, reason string) {
+	rec := r.result(ctx, "quiz_aborted", s)
+	rec.Reason = reason
+	r.write(ctx, rec)
+}
+
+//Close closes the file
+func (r *FileReporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+func (r *FileReporter) record(ctx context.Context, t string, s *db.QuizSession) *Record {
+	return &Record{
+		Time:      time.Now(),
+		Type:      t,
+		SessionID: s.ID,
+		User:      botctx.GetUserName(ctx),
+		Channel:   botctx.GetChannel(ctx),
+		Event:     botctx.GetEvent(ctx),
+		Quiz:      s.Quiz,
+		Referral:  s.Referral,
+	}
+}
+
+func (r *FileReporter) question(ctx context.Context, t string, s *db.QuizSession, q int) *Record {
+	rec := r.record(ctx, t, s)
+	question := s.Questions[q]
+	rec.Question, _ = url.PathUnescape(question.Question)
+	rec.Category = strings.TrimSpace(question.Category)
+	rec.Difficulty = strings.TrimSpace(question.Difficulty)
+	return rec
+}
+
+func (r *FileReporter) result(ctx context.Context, t string, s *db.QuizSession) *Record {
+	rec := r.record(ctx, t, s)
+	score := Score(s)
+	rec.Score = &score
+	rec.Total = len(s.Questions)
+	return rec
+}
+
+func (r *FileReporter) write(ctx context.Context, rec *Record) {
+	b, err := json.Marshal(rec)
+	if nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot marshal result record")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(b, '\n')); nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot write result record")
+	}
+}
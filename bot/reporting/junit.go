@@ -0,0 +1,131 @@
+package reporting
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+type (
+	//JUnitTestSuites is a root element of JUnit XML report
+	JUnitTestSuites struct {
+		XMLName  xml.Name          `xml:"testsuites"`
+		Name     string            `xml:"name,attr"`
+		Tests    int               `xml:"tests,attr"`
+		Failures int               `xml:"failures,attr"`
+		Skipped  int               `xml:"skipped,attr"`
+		Time     string            `xml:"time,attr"`
+		Suites   []*JUnitTestSuite `xml:"testsuite"`
+	}
+
+	//JUnitTestSuite represents single quiz session
+	JUnitTestSuite struct {
+		Name       string           `xml:"name,attr"`
+		Tests      int              `xml:"tests,attr"`
+		Failures   int              `xml:"failures,attr"`
+		Skipped    int              `xml:"skipped,attr"`
+		Time       string           `xml:"time,attr"`
+		Timestamp  string           `xml:"timestamp,attr"`
+		Properties []*JUnitProperty `xml:"properties>property,omitempty"`
+		Cases      []*JUnitTestCase `xml:"testcase"`
+	}
+
+	//JUnitProperty is a suite property
+	JUnitProperty struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	}
+
+	//JUnitTestCase represents single question
+	JUnitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *JUnitFailure `xml:"failure,omitempty"`
+		Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+	}
+
+	//JUnitFailure describes wrong answer
+	JUnitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+
+	//JUnitSkipped describes question which hasn't been answered
+	JUnitSkipped struct {
+		Message string `xml:"message,attr"`
+	}
+)
+
+//NewJUnitReport builds JUnit report where each quiz is a test suite and each question is a test case
+func NewJUnitReport(name string, results []*Result) *JUnitTestSuites {
+	report := &JUnitTestSuites{Name: name, Suites: make([]*JUnitTestSuite, len(results))}
+	var total time.Duration
+	for i, r := range results {
+		suite, d := newJUnitSuite(r)
+		report.Suites[i] = suite
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+		total += d
+	}
+	report.Time = seconds(total)
+	return report
+}
+
+//WriteJUnit writes JUnit XML report of the results
+func WriteJUnit(w io.Writer, name string, results []*Result) error {
+	if _, err := io.WriteString(w, xml.Header); nil != err {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(NewJUnitReport(name, results))
+}
+
+func newJUnitSuite(r *Result) (*JUnitTestSuite, time.Duration) {
+	suite := &JUnitTestSuite{
+		Name:      fmt.Sprintf("quiz: %s", r.User),
+		Tests:     len(r.Answers),
+		Timestamp: r.StartedAt.UTC().Format("2006-01-02T15:04:05"),
+		Properties: []*JUnitProperty{
+			{Name: "session", Value: r.SessionID},
+			{Name: "user", Value: r.User},
+			{Name: "channel", Value: r.Channel},
+			{Name: "event", Value: r.Event},
+			{Name: "score", Value: fmt.Sprintf("%d/%d", r.Score(), len(r.Answers))},
+		},
+		Cases: make([]*JUnitTestCase, len(r.Answers)),
+	}
+
+	var total time.Duration
+	for i, a := range r.Answers {
+		tc := &JUnitTestCase{Name: a.Question, Classname: a.Category, Time: seconds(a.Latency)}
+		switch {
+		case !a.Answered:
+			msg := "not answered"
+			if r.Aborted {
+				msg = fmt.Sprintf("quiz aborted: %s", r.AbortReason)
+			}
+			tc.Skipped = &JUnitSkipped{Message: msg}
+			suite.Skipped++
+		case !a.Passed:
+			tc.Failure = &JUnitFailure{
+				Message: fmt.Sprintf("expected '%s' but was '%s'", a.Correct, a.Answer),
+				Type:    "WrongAnswer",
+				Text:    fmt.Sprintf("Difficulty: %s\nAnswer: %s\nCorrect answer: %s", a.Difficulty, a.Answer, a.Correct),
+			}
+			suite.Failures++
+		}
+		total += a.Latency
+		suite.Cases[i] = tc
+	}
+	suite.Time = seconds(total)
+	return suite, total
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
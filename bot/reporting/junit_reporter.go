@@ -0,0 +1,173 @@
+package reporting
+
+import (
+	"context"
+	"fmt"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+//JUnitReporter records quiz results to the store. If Dir is set, JUnit XML report of each finished quiz is written there
+type JUnitReporter struct {
+	store ResultStore
+	//Dir is a directory reports are written to
+	Dir string
+}
+
+//NewJUnitReporter creates new instance of JUnitReporter
+func NewJUnitReporter(store ResultStore, dir string) *JUnitReporter {
+	return &JUnitReporter{store: store, Dir: dir}
+}
+
+//QuizStarted records new quiz with all its questions
+func (r *JUnitReporter) QuizStarted(ctx context.Context, s *db.QuizSession) {
+	result := &Result{
+		SessionID: s.ID,
+		User:      botctx.GetUserName(ctx),
+		Channel:   botctx.GetChannel(ctx),
+		Event:     botctx.GetEvent(ctx),
+		StartedAt: time.Now(),
+		Answers:   make([]*Answer, len(s.Questions)),
+	}
+	for i, q := range s.Questions {
+		question, _ := url.PathUnescape(q.Question)
+		correct, _ := url.PathUnescape(q.CorrectAnswer)
+		result.Answers[i] = &Answer{
+			Question:   question,
+			Category:   strings.TrimSpace(q.Category),
+			Difficulty: strings.TrimSpace(q.Difficulty),
+			Correct:    strings.TrimSpace(correct),
+		}
+	}
+	if err := r.store.SaveRunning(result); nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot save quiz result")
+	}
+}
+
+// QuestionAsked does nothing
+func (r *JUnitReporter) QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string) {
+}
+
+//QuestionAnswered records answer and its latency
+func (r *JUnitReporter) QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool) {
+	result, err := r.store.Running(s.ID)
+	if nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot load quiz result")
+		return
+	}
+	if q >= len(result.Answers) {
+		return
+	}
+	a := result.Answers[q]
+	a.Answer = answer
+	a.Answered = true
+	a.Passed = passed
+	if !s.QuestionAskedAt.IsZero() {
+		a.Latency = time.Since(s.QuestionAskedAt)
+	}
+	if err := r.store.SaveRunning(result); nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot save quiz result")
+	}
+}
+
+//QuizFinished records finished quiz
+func (r *JUnitReporter) QuizFinished(ctx context.Context, s *db.QuizSession) {
+	r.finish(ctx, s, "")
+}
+
+//QuizAborted records aborted quiz. Questions which aren't answered are reported as skipped
+func (r *JUnitReporter) QuizAborted(ctx context.Context, s *db.QuizSession, reason string) {
+	r.finish(ctx, s, reason)
+}
+
+//finish records finished quiz. Reason is empty unless quiz is aborted
+func (r *JUnitReporter) finish(ctx context.Context, s *db.QuizSession, reason string) {
+	logger := tracing.Logger(ctx)
+	result, err := r.store.Running(s.ID)
+	if db.ErrNotFound == err {
+		return
+	}
+	if nil != err {
+		logger.WithError(err).Error("Cannot load quiz result")
+		return
+	}
+	result.FinishedAt = time.Now()
+	result.Aborted = "" != reason
+	result.AbortReason = reason
+	if err := r.store.Finish(result); nil != err {
+		logger.WithError(err).Error("Cannot save quiz result")
+		return
+	}
+
+	if "" == r.Dir {
+		return
+	}
+	if err := r.write(result); nil != err {
+		logger.WithError(err).Error("Cannot write JUnit report")
+	}
+}
+
+func (r *JUnitReporter) write(result *Result) error {
+	if err := os.MkdirAll(r.Dir, 0755); nil != err {
+		return err
+	}
+	name := fmt.Sprintf("quiz-%s-%s.xml", result.SessionID, result.FinishedAt.UTC().Format("20060102T150405.000"))
+	f, err := os.Create(filepath.Join(r.Dir, name))
+	if nil != err {
+		return err
+	}
+	if err := WriteJUnit(f, "rpquiz", []*Result{result}); nil != err {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//JUnitHandler exports finished quizzes as JUnit XML report.
+//Results can be filtered with 'session', 'event', 'from' and 'to' (RFC3339) query parameters
+func JUnitHandler(store ResultStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, rq *http.Request) {
+		query := rq.URL.Query()
+		f := &Filter{SessionID: query.Get("session"), Event: query.Get("event")}
+
+		var err error
+		if f.From, err = parseTime(query.Get("from")); nil != err {
+			http.Error(w, fmt.Sprintf("Incorrect 'from' parameter: %s", err), http.StatusBadRequest)
+			return
+		}
+		if f.To, err = parseTime(query.Get("to")); nil != err {
+			http.Error(w, fmt.Sprintf("Incorrect 'to' parameter: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		results, err := store.Finished(f)
+		if nil != err {
+			tracing.Logger(rq.Context()).WithError(err).Error("Cannot load quiz results")
+			http.Error(w, "Cannot load quiz results", http.StatusInternalServerError)
+			return
+		}
+
+		name := "rpquiz"
+		if "" != f.Event {
+			name = f.Event
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		if err := WriteJUnit(w, name, results); nil != err {
+			tracing.Logger(rq.Context()).WithError(err).Error("Cannot write JUnit report")
+		}
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if "" == s {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
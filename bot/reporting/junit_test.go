@@ -0,0 +1,84 @@
+package reporting
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJUnitReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "junit")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewMemoryResultStore()
+	r := NewJUnitReporter(store, dir)
+
+	ctx := botctx.WithEvent(botctx.WithUserName(context.Background(), "john"), "conf")
+	s := &db.QuizSession{
+		ID: "1",
+		Questions: []*opentdb.Question{
+			{Category: "Animals", Question: "Are cats cute?", CorrectAnswer: "True"},
+			{Category: "Science", Question: "2+2", CorrectAnswer: "4"},
+			{Category: "Science", Question: "3+3", CorrectAnswer: "6"},
+		},
+		QuestionAskedAt: time.Now().Add(-2 * time.Second),
+	}
+	r.QuizStarted(ctx, s)
+	r.QuestionAnswered(ctx, s, 0, "True", true)
+	r.QuestionAnswered(ctx, s, 1, "5", false)
+	r.QuizAborted(ctx, s, AbortExit)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if 1 != len(files) {
+		t.Fatalf("expected one report file, got %d", len(files))
+	}
+
+	rs := httptest.NewRecorder()
+	JUnitHandler(store).ServeHTTP(rs, httptest.NewRequest(http.MethodGet, "/api/v1/results/junit?event=conf", nil))
+	if http.StatusOK != rs.Code {
+		t.Fatalf("unexpected status %d", rs.Code)
+	}
+
+	var report JUnitTestSuites
+	if err := xml.Unmarshal(rs.Body.Bytes(), &report); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(report.Suites) || 3 != report.Tests || 1 != report.Failures || 1 != report.Skipped {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	suite := report.Suites[0]
+	if "quiz: john" != suite.Name || nil == suite.Cases[1].Failure || nil == suite.Cases[2].Skipped {
+		t.Fatalf("unexpected suite: %+v", suite)
+	}
+	if "0.000" == suite.Cases[0].Time {
+		t.Fatal("expected answer latency to be reported")
+	}
+
+	rs = httptest.NewRecorder()
+	JUnitHandler(store).ServeHTTP(rs, httptest.NewRequest(http.MethodGet, "/api/v1/results/junit?event=other", nil))
+	var filtered JUnitTestSuites
+	if err := xml.Unmarshal(rs.Body.Bytes(), &filtered); nil != err {
+		t.Fatal(err)
+	}
+	if 0 != len(filtered.Suites) {
+		t.Fatalf("expected results to be filtered by event, got %d", len(filtered.Suites))
+	}
+
+	rs = httptest.NewRecorder()
+	JUnitHandler(store).ServeHTTP(rs, httptest.NewRequest(http.MethodGet, "/api/v1/results/junit?from=yesterday", nil))
+	if http.StatusBadRequest != rs.Code {
+		t.Fatalf("expected bad request, got %d", rs.Code)
+	}
+}
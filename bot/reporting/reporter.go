@@ -0,0 +1,105 @@
+package reporting
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+)
+
+const (
+	//AbortExit is a reason of the quiz quit by the user
+	AbortExit = "user aborted"
+	//AbortTimeout is a reason of the quiz abandoned by the user
+	AbortTimeout = "timed out"
+	//AbortRestart is a reason of the quiz replaced by the new one
+	AbortRestart = "restarted"
+)
+
+type (
+	//ResultReporter reports quiz progress and results somewhere (ReportPortal, file, etc).
+	//Reporters may keep their state in the session, session is persisted by the caller
+	ResultReporter interface {
+		//QuizStarted is called once new quiz is started
+		QuizStarted(ctx context.Context, s *db.QuizSession)
+		//QuestionAsked is called once question with the given index is asked with the given options
+		QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string)
+		//QuestionAnswered is called once question with the given index is answered
+		QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool)
+		//QuizFinished is called once all the questions are answered
+		QuizFinished(ctx context.Context, s *db.QuizSession)
+		//QuizAborted is called once quiz is quit before all the questions are answered
+		QuizAborted(ctx context.Context, s *db.QuizSession, reason string)
+	}
+
+	//Noop is a reporter which reports nothing
+	Noop struct{}
+
+	//FanOut reports results to each of the reporters
+	FanOut []ResultReporter
+)
+
+//NewFanOut creates reporter which reports results to each of the given reporters
+func NewFanOut(reporters ...ResultReporter) FanOut {
+	return FanOut(reporters)
+}
+
+//QuizStarted does nothing
+func (Noop) QuizStarted(ctx context.Context, s *db.QuizSession) {}
+
+//QuestionAsked does nothing
+func (Noop) QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string) {}
+
+//QuestionAnswered does nothing
+func (Noop) QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool) {
+}
+
+//QuizFinished does nothing
+func (Noop) QuizFinished(ctx context.Context, s *db.QuizSession) {}
+
+//QuizAborted does nothing
+func (Noop) QuizAborted(ctx context.Context, s *db.QuizSession, reason string) {}
+
+//QuizStarted reports quiz start to each of the reporters
+func (f FanOut) QuizStarted(ctx context.Context, s *db.QuizSession) {
+	for _, r := range f {
+		r.QuizStarted(ctx, s)
+	}
+}
+
+//QuestionAsked reports question to each of the reporters
+func (f FanOut) QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string) {
+	for _, r := range f {
+		r.QuestionAsked(ctx, s, q, options)
+	}
+}
+
+//QuestionAnswered reports answer to each of the reporters
+func (f FanOut) QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool) {
+	for _, r := range f {
+		r.QuestionAnswered(ctx, s, q, answer, passed)
+	}
+}
+
+//QuizFinished reports quiz finish to each of the reporters
+func (f FanOut) QuizFinished(ctx context.Context, s *db.QuizSession) {
+	for _, r := range f {
+		r.QuizFinished(ctx, s)
+	}
+}
+
+//QuizAborted reports quiz abort to each of the reporters
+func (f FanOut) QuizAborted(ctx context.Context, s *db.QuizSession, reason string) {
+	for _, r := range f {
+		r.QuizAborted(ctx, s, reason)
+	}
+}
+
+//Score calculates number of correct answers
+func Score(s *db.QuizSession) int {
+	score := 0
+	for _, success := range s.Results {
+		if success {
+			score++
+		}
+	}
+	return score
+}
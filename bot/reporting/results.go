@@ -0,0 +1,321 @@
+package reporting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/asdine/storm/v3"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	//Result is a result of a single quiz
+	Result struct {
+		//ID of the finished result starts with finish time, so results are kept in the order they are finished
+		ID         string `storm:"id"`
+		SessionID  string
+		User       string
+		Channel    string
+		Event      string
+		StartedAt  time.Time
+		FinishedAt time.Time
+		Aborted    bool
+		//AbortReason is a reason quiz has been aborted with
+		AbortReason string
+		Answers     []*Answer
+	}
+
+	//Answer is a result of a single question. Questions which are not answered have Answered flag unset
+	Answer struct {
+		Question   string
+		Category   string
+		Difficulty string
+		Correct    string
+		Answer     string
+		Answered   bool
+		Passed     bool
+		Latency    time.Duration
+	}
+
+	//Filter selects finished results
+	Filter struct {
+		SessionID string
+		Event     string
+		//From and To limit time quiz is finished at. Ignored if zero
+		From time.Time
+		To   time.Time
+	}
+
+	//ResultStore keeps results of running and finished quizzes
+	ResultStore interface {
+		//SaveRunning inserts/updates result of a quiz in progress. There is one running quiz per session
+		SaveRunning(r *Result) error
+		//Running loads result of a quiz in progress. Returns db.ErrNotFound if there is no such quiz
+		Running(sessionID string) (*Result, error)
+		//Finish moves result from running to finished ones
+		Finish(r *Result) error
+		//Finished loads finished results matching the filter ordered by finish time
+		Finished(f *Filter) ([]*Result, error)
+	}
+
+	//Retention limits finished results kept in the store. Older results are removed once quiz is finished
+	Retention struct {
+		//TTL is a time result is kept after quiz is finished. Zero means no limit
+		TTL time.Duration
+		//Max is a max number of results kept. Zero means no limit
+		Max int
+	}
+
+	//StormResultStore is a BoltDB-backed result store
+	StormResultStore struct {
+		Retention
+		bdb      *storm.DB
+		running  storm.Node
+		finished storm.Node
+	}
+
+	//MemoryResultStore keeps results in memory
+	MemoryResultStore struct {
+		Retention
+		mu       sync.Mutex
+		running  map[string]*Result
+		finished []*Result
+	}
+
+	//filterMatcher selects results matching the filter while storm iterates the bucket
+	filterMatcher struct {
+		f *Filter
+	}
+)
+
+//Match checks whether result matches the filter
+func (f *Filter) Match(r *Result) bool {
+	if "" != f.SessionID && f.SessionID != r.SessionID {
+		return false
+	}
+	if "" != f.Event && f.Event != r.Event {
+		return false
+	}
+	if !f.From.IsZero() && r.FinishedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && r.FinishedAt.After(f.To) {
+		return false
+	}
+	return true
+}
+
+//Match checks whether record decoded by storm is a result matching the filter
+func (m filterMatcher) Match(i interface{}) (bool, error) {
+	switch r := i.(type) {
+	case Result:
+		return nil == m.f || m.f.Match(&r), nil
+	case *Result:
+		return nil == m.f || m.f.Match(r), nil
+	}
+	return false, fmt.Errorf("unexpected record %T", i)
+}
+
+//expired checks whether result finished at the given time is out of TTL
+func (r Retention) expired(finishedAt, now time.Time) bool {
+	return 0 != r.TTL && finishedAt.Before(now.Add(-r.TTL))
+}
+
+//Score calculates number of correct answers
+func (r *Result) Score() int {
+	score := 0
+	for _, a := range r.Answers {
+		if a.Passed {
+			score++
+		}
+	}
+	return score
+}
+
+//NewStormResultStore creates new instance of StormResultStore and makes sure BoltDB buckets are created
+func NewStormResultStore(bdb *storm.DB) (*StormResultStore, error) {
+	s := &StormResultStore{
+		bdb:      bdb,
+		running:  bdb.From("results", "running"),
+		finished: bdb.From("results", "finished"),
+	}
+	if err := s.running.Init(&Result{}); nil != err {
+		return nil, err
+	}
+	if err := s.finished.Init(&Result{}); nil != err {
+		return nil, err
+	}
+	return s, nil
+}
+
+//SaveRunning inserts/updates result of a quiz in progress
+func (s *StormResultStore) SaveRunning(r *Result) error {
+	r.ID = r.SessionID
+	return s.running.Save(r)
+}
+
+//Running loads result of a quiz in progress
+func (s *StormResultStore) Running(sessionID string) (*Result, error) {
+	var r Result
+	err := s.running.One("ID", sessionID, &r)
+	if storm.ErrNotFound == err {
+		return nil, db.ErrNotFound
+	}
+	if nil != err {
+		return nil, err
+	}
+	return &r, nil
+}
+
+//Finish moves result from running to finished ones and removes results which are out of retention
+func (s *StormResultStore) Finish(r *Result) error {
+	if err := s.running.DeleteStruct(&Result{ID: r.SessionID}); nil != err && storm.ErrNotFound != err {
+		return err
+	}
+	r.ID = newResultID(r.FinishedAt)
+	if err := s.finished.Save(r); nil != err {
+		return err
+	}
+	return s.prune(time.Now())
+}
+
+//Finished loads finished results matching the filter. Results are filtered while bucket is iterated,
+//so only matching ones are decoded into memory
+func (s *StormResultStore) Finished(f *Filter) ([]*Result, error) {
+	results := []*Result{}
+	err := s.finished.Select(filterMatcher{f: f}).OrderBy("FinishedAt").Find(&results)
+	if nil != err && storm.ErrNotFound != err {
+		return nil, err
+	}
+	return results, nil
+}
+
+//prune removes the oldest results out of retention. Keys start with finish time, so results aren't decoded
+//and only keys of the removed ones and of Max most recent ones are iterated
+func (s *StormResultStore) prune(now time.Time) error {
+	if 0 == s.TTL && 0 == s.Max {
+		return nil
+	}
+	cutoff := ""
+	if 0 != s.TTL {
+		cutoff = resultIDPrefix(now.Add(-s.TTL))
+	}
+	return s.bdb.Bolt.Update(func(tx *bolt.Tx) error {
+		node := s.finished.WithTransaction(tx)
+		b := node.GetBucket(tx, "Result")
+		if nil == b {
+			return nil
+		}
+		c := b.Cursor()
+		//results older than the last of Max most recent ones are removed
+		oldest := ""
+		if 0 != s.Max {
+			n := 0
+			for k, v := c.Last(); nil != k && n < s.Max; k, v = c.Prev() {
+				//nested buckets, e.g. storm indexes
+				if nil != v {
+					oldest = string(k)
+					n++
+				}
+			}
+		}
+
+		var ids []string
+		for k, v := c.First(); nil != k; k, v = c.Next() {
+			if nil == v {
+				continue
+			}
+			if string(k) >= oldest && string(k) >= cutoff {
+				break
+			}
+			ids = append(ids, string(k))
+		}
+		for _, id := range ids {
+			if err := node.DeleteStruct(&Result{ID: id}); nil != err && storm.ErrNotFound != err {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//NewMemoryResultStore creates new instance of MemoryResultStore
+func NewMemoryResultStore() *MemoryResultStore {
+	return &MemoryResultStore{running: map[string]*Result{}}
+}
+
+//SaveRunning inserts/updates result of a quiz in progress
+func (s *MemoryResultStore) SaveRunning(r *Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = r.SessionID
+	s.running[r.SessionID] = r
+	return nil
+}
+
+//Running loads result of a quiz in progress
+func (s *MemoryResultStore) Running(sessionID string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.running[sessionID]
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	return r, nil
+}
+
+//Finish moves result from running to finished ones
+func (s *MemoryResultStore) Finish(r *Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, r.SessionID)
+	r.ID = newResultID(r.FinishedAt)
+	s.finished = append(s.finished, r)
+
+	//results are appended in the order they are finished, so the oldest ones are removed from the head
+	now := time.Now()
+	pruned := 0
+	for pruned < len(s.finished) &&
+		((0 != s.Max && len(s.finished)-pruned > s.Max) || s.expired(s.finished[pruned].FinishedAt, now)) {
+		pruned++
+	}
+	s.finished = s.finished[pruned:]
+	return nil
+}
+
+//Finished loads finished results matching the filter
+func (s *MemoryResultStore) Finished(f *Filter) ([]*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return filterResults(s.finished, f), nil
+}
+
+func filterResults(all []*Result, f *Filter) []*Result {
+	results := []*Result{}
+	for _, r := range all {
+		if nil == f || f.Match(r) {
+			results = append(results, r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].FinishedAt.Before(results[j].FinishedAt)
+	})
+	return results
+}
+
+//newResultID generates ID of the result finished at the given time. IDs are ordered by finish time
+func newResultID(finishedAt time.Time) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); nil != err {
+		panic(err)
+	}
+	return resultIDPrefix(finishedAt) + hex.EncodeToString(b)
+}
+
+func resultIDPrefix(t time.Time) string {
+	return fmt.Sprintf("%016x", t.UnixNano())
+}
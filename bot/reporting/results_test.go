@@ -0,0 +1,77 @@
+package reporting
+
+import (
+	"github.com/asdine/storm/v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResultStoreRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bdb, err := storm.Open(filepath.Join(dir, "test.db"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	stormStore, err := NewStormResultStore(bdb)
+	if nil != err {
+		t.Fatal(err)
+	}
+	stormStore.Retention = Retention{TTL: time.Hour, Max: 3}
+	memoryStore := NewMemoryResultStore()
+	memoryStore.Retention = Retention{TTL: time.Hour, Max: 3}
+
+	for name, store := range map[string]ResultStore{"storm": stormStore, "memory": memoryStore} {
+		now := time.Now()
+		finish := func(session, event string, finishedAt time.Time) {
+			r := &Result{SessionID: session, Event: event, FinishedAt: finishedAt}
+			if err := store.SaveRunning(r); nil != err {
+				t.Fatal(err)
+			}
+			if err := store.Finish(r); nil != err {
+				t.Fatal(err)
+			}
+		}
+
+		//out of TTL
+		finish("expired", "conf", now.Add(-2*time.Hour))
+		finish("1", "conf", now.Add(-4*time.Minute))
+		finish("2", "other", now.Add(-3*time.Minute))
+		if rs, err := store.Finished(nil); nil != err || 2 != len(rs) || "1" != rs[0].SessionID {
+			t.Errorf("%s: expected expired result to be removed, got %v %v", name, sessions(rs), err)
+		}
+
+		//over max count
+		finish("3", "conf", now.Add(-2*time.Minute))
+		finish("4", "conf", now.Add(-time.Minute))
+		if rs, err := store.Finished(nil); nil != err || 3 != len(rs) || "2" != rs[0].SessionID {
+			t.Errorf("%s: expected the oldest result to be removed, got %v %v", name, sessions(rs), err)
+		}
+
+		rs, err := store.Finished(&Filter{Event: "conf", From: now.Add(-150 * time.Second)})
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 2 != len(rs) || "3" != rs[0].SessionID || "4" != rs[1].SessionID {
+			t.Errorf("%s: expected filtered results ordered by finish time, got %v", name, sessions(rs))
+		}
+		if rs, err := store.Finished(&Filter{Event: "none"}); nil != err || 0 != len(rs) {
+			t.Errorf("%s: expected no results, got %v %v", name, sessions(rs), err)
+		}
+	}
+}
+
+func sessions(rs []*Result) []string {
+	ids := make([]string, len(rs))
+	for i, r := range rs {
+		ids[i] = r.SessionID
+	}
+	return ids
+}
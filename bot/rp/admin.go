@@ -0,0 +1,31 @@
+package rp
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+//FinishLaunchesHandler finishes shared launch of the event given by 'event' query parameter once the event is over.
+//If event isn't given, all the shared launches are finished. Responds with the list of finished launch keys
+func FinishLaunchesHandler(r *Reporter) http.HandlerFunc {
+	return func(w http.ResponseWriter, rq *http.Request) {
+		keys := r.SharedLaunches()
+		if event, ok := rq.URL.Query()["event"]; ok {
+			keys = event[:1]
+		}
+
+		finished := []string{}
+		for _, key := range keys {
+			if r.FinishSharedLaunch(rq.Context(), key) {
+				finished = append(finished, key)
+			}
+		}
+		if 0 == len(finished) && 0 != len(keys) {
+			http.Error(w, "Shared launch isn't found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]string{"finished": finished})
+	}
+}
@@ -0,0 +1,158 @@
+package rp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/resty.v1"
+	"net/http"
+	"time"
+)
+
+type (
+	//Timestamp is a time serialized as milliseconds since epoch
+	Timestamp struct {
+		time.Time
+	}
+
+	//StartRQ holds common attributes of the started launch or item
+	StartRQ struct {
+		Name        string    `json:"name,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Tags        []string  `json:"tags,omitempty"`
+		StartTime   Timestamp `json:"start_time,omitempty"`
+	}
+
+	//StartLaunchRQ is a request to start launch
+	StartLaunchRQ struct {
+		StartRQ
+		Mode string `json:"mode,omitempty"`
+	}
+
+	//StartTestRQ is a request to start test item, e.g. suite or test
+	StartTestRQ struct {
+		StartRQ
+		Type     string `json:"type,omitempty"`
+		LaunchID string `json:"launch_id,omitempty"`
+	}
+
+	//FinishExecutionRQ is a request to finish launch or item
+	FinishExecutionRQ struct {
+		EndTime     Timestamp `json:"end_time,omitempty"`
+		Status      string    `json:"status,omitempty"`
+		Description string    `json:"description,omitempty"`
+		Tags        []string  `json:"tags,omitempty"`
+	}
+
+	//FinishTestRQ is a request to finish test item. Issue describes defect of the failed or skipped test
+	FinishTestRQ struct {
+		FinishExecutionRQ
+		Issue *Issue `json:"issue,omitempty"`
+	}
+
+	//Issue is a defect of the test item
+	Issue struct {
+		IssueType string `json:"issue_type,omitempty"`
+		Comment   string `json:"comment,omitempty"`
+	}
+
+	//SaveLogRQ is a request to attach log entry to the item
+	SaveLogRQ struct {
+		ItemID  string    `json:"item_id,omitempty"`
+		LogTime Timestamp `json:"time,omitempty"`
+		Message string    `json:"message,omitempty"`
+		Level   string    `json:"level,omitempty"`
+	}
+
+	//EntryCreatedRS is a response with ID of the created entity
+	EntryCreatedRS struct {
+		ID string `json:"id,omitempty"`
+	}
+
+	//FinishLaunchRS is a response to launch finish
+	FinishLaunchRS struct {
+		EntryCreatedRS
+		Link string `json:"link,omitempty"`
+	}
+
+	//MsgRS is a response with a message
+	MsgRS struct {
+		Msg string `json:"msg,omitempty"`
+	}
+
+	//HTTPClient is a ReportPortal API client
+	HTTPClient struct {
+		http *resty.Client
+	}
+)
+
+//MarshalJSON serializes timestamp as milliseconds since epoch
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.UnixNano() / int64(time.Millisecond))
+}
+
+//NewClient creates new instance of HTTPClient reporting to the project with the given UUID
+func NewClient(host, project, uuid string) *HTTPClient {
+	return &HTTPClient{
+		http: resty.NewWithClient(&http.Client{}).
+			SetHostURL(fmt.Sprintf("%s/api/v1/%s", host, project)).
+			SetAuthToken(uuid),
+	}
+}
+
+//StartLaunch starts new launch
+func (c *HTTPClient) StartLaunch(rq *StartLaunchRQ) (*EntryCreatedRS, error) {
+	var rs EntryCreatedRS
+	return &rs, c.do(http.MethodPost, "/launch", rq, &rs)
+}
+
+//FinishLaunch finishes launch
+func (c *HTTPClient) FinishLaunch(id string, rq *FinishExecutionRQ) (*FinishLaunchRS, error) {
+	var rs FinishLaunchRS
+	return &rs, c.do(http.MethodPut, fmt.Sprintf("/launch/%s/finish", id), rq, &rs)
+}
+
+//StopLaunch force stops launch which cannot be finished
+func (c *HTTPClient) StopLaunch(id string) (*MsgRS, error) {
+	var rs MsgRS
+	return &rs, c.do(http.MethodPut, fmt.Sprintf("/launch/%s/stop", id), nil, &rs)
+}
+
+//StartTest starts root item of the launch
+func (c *HTTPClient) StartTest(rq *StartTestRQ) (*EntryCreatedRS, error) {
+	var rs EntryCreatedRS
+	return &rs, c.do(http.MethodPost, "/item", rq, &rs)
+}
+
+//StartChildTest starts item under the given parent
+func (c *HTTPClient) StartChildTest(parent string, rq *StartTestRQ) (*EntryCreatedRS, error) {
+	var rs EntryCreatedRS
+	return &rs, c.do(http.MethodPost, fmt.Sprintf("/item/%s", parent), rq, &rs)
+}
+
+//FinishTest finishes item
+func (c *HTTPClient) FinishTest(id string, rq *FinishTestRQ) (*MsgRS, error) {
+	var rs MsgRS
+	return &rs, c.do(http.MethodPut, fmt.Sprintf("/item/%s", id), rq, &rs)
+}
+
+//SaveLog attaches log entry to the item
+func (c *HTTPClient) SaveLog(rq *SaveLogRQ) (*EntryCreatedRS, error) {
+	var rs EntryCreatedRS
+	return &rs, c.do(http.MethodPost, "/log", rq, &rs)
+}
+
+func (c *HTTPClient) do(method, path string, body, rs interface{}) error {
+	rq := c.http.NewRequest().SetResult(rs)
+	if nil != body {
+		rq.SetBody(body)
+	}
+	resp, err := rq.Execute(method, path)
+	if nil != err {
+		return err
+	}
+	if resp.IsError() {
+		return errors.Errorf("unexpected status code: %d. %s", resp.StatusCode(), resp.String())
+	}
+	return nil
+}
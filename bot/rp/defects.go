@@ -0,0 +1,205 @@
+package rp
+
+import (
+	"context"
+	"fmt"
+	"github.com/avarabyeu/rpquiz/bot/reporting"
+	"github.com/pkg/errors"
+	"gopkg.in/resty.v1"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	//IssueToInvestigate is a locator of RP 'To Investigate' issue type
+	IssueToInvestigate = "TI001"
+	//IssueSystemIssue is a locator of RP 'System Issue' issue type
+	IssueSystemIssue = "SI001"
+	//IssueNoDefect is a locator of RP 'No Defect' issue type
+	IssueNoDefect = "ND001"
+	//IssueProductBug is a locator of RP 'Product Bug' issue type
+	IssueProductBug = "PB001"
+
+	//KnowledgeGap is a name of the Product Bug subtype wrong answers are classified with by default
+	KnowledgeGap      = "Knowledge Gap"
+	knowledgeGapShort = "KG"
+	knowledgeGapColor = "#ffb743"
+)
+
+//Defects classifies wrong answers and skipped questions with RP issue types
+type Defects struct {
+	//WrongAnswer is an issue type of wrong answers in categories which aren't mapped.
+	//If empty, Knowledge Gap type is looked up or created on startup, see EnsureKnowledgeGap
+	WrongAnswer string
+	//Categories maps question categories to issue types of wrong answers
+	Categories map[string]string
+	//Timeout is an issue type of questions skipped because quiz is abandoned
+	Timeout string
+	//Aborted is an issue type of questions skipped because quiz is quit
+	Aborted string
+}
+
+//settings is a subset of RP project settings
+type settings struct {
+	SubTypes map[string][]*struct {
+		Locator  string `json:"locator"`
+		LongName string `json:"longName"`
+	} `json:"subTypes"`
+}
+
+//NewDefects creates classification with RP built-in issue types. Wrong answers are a knowledge gap
+//rather than something to investigate, so they are classified once Knowledge Gap type is resolved
+func NewDefects() *Defects {
+	return &Defects{
+		Categories: map[string]string{},
+		Timeout:    IssueSystemIssue,
+		Aborted:    IssueNoDefect,
+	}
+}
+
+//ParseDefects parses classification in format 'wrong=TI001;wrong:Science & Nature=KG001;timeout=SI001;aborted=ND001'.
+//Issue types which aren't specified have their default values
+func ParseDefects(s string) (*Defects, error) {
+	d := NewDefects()
+	for _, entry := range strings.Split(s, ";") {
+		if "" == strings.TrimSpace(entry) {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if 2 != len(kv) || "" == strings.TrimSpace(kv[1]) {
+			return nil, errors.Errorf("incorrect defect mapping '%s'", entry)
+		}
+		key, locator := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		switch {
+		case "wrong" == key:
+			d.WrongAnswer = locator
+		case strings.HasPrefix(key, "wrong:"):
+			d.Categories[strings.TrimSpace(strings.TrimPrefix(key, "wrong:"))] = locator
+		case "timeout" == key:
+			d.Timeout = locator
+		case "aborted" == key:
+			d.Aborted = locator
+		default:
+			return nil, errors.Errorf("unknown defect mapping key '%s'", key)
+		}
+	}
+	return d, nil
+}
+
+//ForAnswer returns issue type of wrong answer to the question of the given category
+func (d *Defects) ForAnswer(category string) string {
+	if locator, ok := d.Categories[strings.TrimSpace(category)]; ok {
+		return locator
+	}
+	if "" == d.WrongAnswer {
+		//Knowledge Gap isn't resolved, still it's a product bug rather than an issue to investigate
+		return IssueProductBug
+	}
+	return d.WrongAnswer
+}
+
+//ForAbort returns issue type of questions skipped because of quiz is aborted with the given reason
+func (d *Defects) ForAbort(reason string) string {
+	if reporting.AbortTimeout == reason {
+		return d.Timeout
+	}
+	return d.Aborted
+}
+
+//Validate makes sure all the issue types are known by the project. Known types map locators to names
+func (d *Defects) Validate(known map[string]string) error {
+	wrong := d.WrongAnswer
+	if "" == wrong {
+		wrong = IssueProductBug
+	}
+	locators := map[string]bool{wrong: true, d.Timeout: true, d.Aborted: true}
+	for _, locator := range d.Categories {
+		locators[locator] = true
+	}
+
+	var unknown []string
+	for locator := range locators {
+		if _, ok := known[locator]; !ok {
+			unknown = append(unknown, locator)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.Errorf("unknown RP issue types: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+//EnsureKnowledgeGap returns locator of the Knowledge Gap subtype of Product Bug of the project.
+//Subtype is created if project doesn't have it. Known types map locators to names
+func EnsureKnowledgeGap(ctx context.Context, host, project, uuid string, known map[string]string) (string, error) {
+	if locator, ok := findIssueType(known, KnowledgeGap); ok {
+		return locator, nil
+	}
+	resp, err := resty.NewWithClient(&http.Client{}).
+		SetHostURL(fmt.Sprintf("%s/api/v1/%s", host, project)).
+		SetAuthToken(uuid).
+		NewRequest().
+		SetContext(ctx).
+		SetBody(map[string]string{
+			"typeRef":   "PRODUCT_BUG",
+			"longName":  KnowledgeGap,
+			"shortName": knowledgeGapShort,
+			"color":     knowledgeGapColor,
+		}).
+		Post("/settings/sub-type")
+	if nil != err {
+		return "", err
+	}
+	if resp.IsError() {
+		return "", errors.Errorf("cannot create %s issue type, unexpected status code: %d", KnowledgeGap, resp.StatusCode())
+	}
+
+	//locator is generated by RP and isn't returned on creation
+	types, err := FetchIssueTypes(ctx, host, project, uuid)
+	if nil != err {
+		return "", err
+	}
+	if locator, ok := findIssueType(types, KnowledgeGap); ok {
+		known[locator] = KnowledgeGap
+		return locator, nil
+	}
+	return "", errors.Errorf("%s issue type isn't found once created", KnowledgeGap)
+}
+
+//findIssueType looks up locator of the issue type by its name ignoring case
+func findIssueType(known map[string]string, name string) (string, bool) {
+	for locator, n := range known {
+		if strings.EqualFold(strings.TrimSpace(n), name) {
+			return locator, true
+		}
+	}
+	return "", false
+}
+
+//FetchIssueTypes loads issue types of the project from RP. Returns map of locators to names
+func FetchIssueTypes(ctx context.Context, host, project, uuid string) (map[string]string, error) {
+	var s settings
+	resp, err := resty.NewWithClient(&http.Client{}).
+		SetHostURL(fmt.Sprintf("%s/api/v1/%s", host, project)).
+		SetAuthToken(uuid).
+		NewRequest().
+		SetContext(ctx).
+		SetResult(&s).
+		Get("/settings")
+	if nil != err {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, errors.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+
+	types := map[string]string{}
+	for _, subTypes := range s.SubTypes {
+		for _, t := range subTypes {
+			types[t.Locator] = t.LongName
+		}
+	}
+	return types, nil
+}
@@ -0,0 +1,105 @@
+package rp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseDefects(t *testing.T) {
+	d, err := ParseDefects("wrong=PB001; wrong:Entertainment: Music=KG001;timeout=SI001")
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "KG001" != d.ForAnswer("Entertainment: Music") || "PB001" != d.ForAnswer("Animals") {
+		t.Errorf("Unexpected wrong answer classification: %+v", d)
+	}
+	if IssueSystemIssue != d.ForAbort("timed out") || IssueNoDefect != d.ForAbort("user aborted") {
+		t.Errorf("Unexpected abort classification: %+v", d)
+	}
+
+	if _, err := ParseDefects("unknown=TI001"); nil == err {
+		t.Error("Expected unknown key to be rejected")
+	}
+}
+
+func TestValidateDefects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		if "/api/v1/test/settings" != rq.URL.Path {
+			http.NotFound(w, rq)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"subTypes":{
+			"TO_INVESTIGATE":[{"locator":"TI001","longName":"To Investigate"}],
+			"SYSTEM_ISSUE":[{"locator":"SI001","longName":"System Issue"}],
+			"NO_DEFECT":[{"locator":"ND001","longName":"No Defect"}],
+			"PRODUCT_BUG":[{"locator":"PB001","longName":"Product Bug"},{"locator":"pb_kg","longName":"Knowledge Gap"}]}}`))
+	}))
+	defer srv.Close()
+
+	types, err := FetchIssueTypes(context.Background(), srv.URL, "test", "uuid")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	d, _ := ParseDefects("wrong:Animals=pb_kg")
+	if err := d.Validate(types); nil != err {
+		t.Errorf("Expected classification to be valid: %s", err)
+	}
+	d, _ = ParseDefects("wrong:Animals=unknown")
+	if err := d.Validate(types); nil == err {
+		t.Error("Expected unknown issue type to be rejected")
+	}
+}
+
+func TestWrongAnswersAreKnowledgeGapByDefault(t *testing.T) {
+	d := NewDefects()
+	if IssueProductBug != d.ForAnswer("Animals") {
+		t.Errorf("Expected wrong answer to be a product bug until Knowledge Gap is resolved, got %s", d.ForAnswer("Animals"))
+	}
+
+	created := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case http.MethodPost == rq.Method && "/api/v1/test/settings/sub-type" == rq.URL.Path:
+			created++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 100}`))
+		case "/api/v1/test/settings" == rq.URL.Path:
+			kg := ""
+			if created > 0 {
+				kg = `,{"locator":"pb_kg","longName":"Knowledge Gap"}`
+			}
+			w.Write([]byte(`{"subTypes":{"SYSTEM_ISSUE":[{"locator":"SI001","longName":"System Issue"}],
+				"NO_DEFECT":[{"locator":"ND001","longName":"No Defect"}],
+				"PRODUCT_BUG":[{"locator":"PB001","longName":"Product Bug"}` + kg + `]}}`))
+		default:
+			http.NotFound(w, rq)
+		}
+	}))
+	defer srv.Close()
+
+	types, err := FetchIssueTypes(context.Background(), srv.URL, "test", "uuid")
+	if nil != err {
+		t.Fatal(err)
+	}
+	locator, err := EnsureKnowledgeGap(context.Background(), srv.URL, "test", "uuid", types)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if "pb_kg" != locator || 1 != created {
+		t.Errorf("Expected Knowledge Gap type to be created once, got '%s' created %d times", locator, created)
+	}
+	d.WrongAnswer = locator
+	if err := d.Validate(types); nil != err {
+		t.Errorf("Expected created type to be known: %s", err)
+	}
+
+	//existing type is reused
+	if locator, _ := EnsureKnowledgeGap(context.Background(), srv.URL, "test", "uuid", types); "pb_kg" != locator || 1 != created {
+		t.Errorf("Expected existing Knowledge Gap type to be reused, got '%s' created %d times", locator, created)
+	}
+}
@@ -0,0 +1,38 @@
+package rp
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/resty.v1"
+	"net/http"
+)
+
+//Pinger checks ReportPortal is reachable and credentials are valid
+type Pinger struct {
+	http *resty.Client
+}
+
+//NewPinger creates new instance of Pinger
+func NewPinger(host, project, uuid string) *Pinger {
+	return &Pinger{
+		http: resty.NewWithClient(&http.Client{}).
+			SetHostURL(fmt.Sprintf("%s/api/v1/%s", host, project)).
+			SetAuthToken(uuid),
+	}
+}
+
+//Check requests the latest launch of the project which requires valid credentials
+func (p *Pinger) Check(ctx context.Context) error {
+	resp, err := p.http.NewRequest().
+		SetContext(ctx).
+		SetQueryParam("page.size", "1").
+		Get("/launch")
+	if nil != err {
+		return err
+	}
+	if resp.IsError() {
+		return errors.Errorf("unexpected status code: %d", resp.StatusCode())
+	}
+	return nil
+}
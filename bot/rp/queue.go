@@ -0,0 +1,299 @@
+package rp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+	"sync"
+	"time"
+)
+
+const (
+	eventStartLaunch  = "start_launch"
+	eventStartTest    = "start_test"
+	eventFinishTest   = "finish_test"
+	eventFinishLaunch = "finish_launch"
+	eventLog          = "log"
+
+	//queuesBucket keeps a bucket of events and a bucket of item IDs per launch
+	queuesBucket = "queues"
+	eventsBucket = "events"
+	idsBucket    = "ids"
+)
+
+type (
+	//Event is a reporting operation waiting to be sent to ReportPortal.
+	//Items are referenced by temporary IDs which are resolved to real RP IDs once items are started
+	Event struct {
+		//Seq is a position of the event in the launch queue
+		Seq      uint64
+		Type     string
+		ItemID   string
+		ParentID string
+		Name     string
+		ItemType string
+		Status   string
+		Time     time.Time
+		//Attributes of the started item
+		Attributes map[string]string
+		//IssueType and IssueComment describe defect of the finished test
+		IssueType    string
+		IssueComment string
+		//Description of the finished item or launch
+		Description string
+		//Message and Level of the log entry
+		Message string
+		Level   string
+	}
+
+	//Queue is an ordered list of pending events of a single launch
+	Queue struct {
+		//ID is a temporary ID of the launch
+		ID string `storm:"id"`
+		//Key is a key of the shared launch. Empty for launches which aren't shared
+		Key string
+		//Events and IDs are persisted one by one as queue changes, so they aren't saved with the queue
+		Events []*Event `json:"-"`
+		//IDs maps temporary IDs of the items which are in progress to real RP IDs
+		IDs map[string]string `json:"-"`
+	}
+
+	//QueueStore persists pending events so they survive restart. Only changes of the queue are persisted,
+	//so cost of the change doesn't depend on the queue size
+	QueueStore interface {
+		//Save inserts/updates ID and key of the queue
+		Save(q *Queue) error
+		//Push appends events to the queue
+		Push(launchID string, events ...*Event) error
+		//Pop removes sent event from the queue. Real IDs of the created items are added,
+		//IDs of the finished items are removed since they aren't referenced anymore
+		Pop(launchID string, seq uint64, resolved map[string]string, finished ...string) error
+		//Delete removes queue with all its events and IDs
+		Delete(id string) error
+		//All loads all the pending queues
+		All() ([]*Queue, error)
+	}
+
+	//StormQueueStore is a BoltDB-backed queue store
+	StormQueueStore struct {
+		db *storm.DB
+	}
+
+	//MemoryQueueStore keeps queues in memory. Pending events are lost on restart
+	MemoryQueueStore struct {
+		mu     sync.Mutex
+		queues map[string]*Queue
+	}
+)
+
+//NewStormQueueStore creates new instance of StormQueueStore and makes sure BoltDB bucket is created
+func NewStormQueueStore(db *storm.DB) (*StormQueueStore, error) {
+	if err := db.Init(&Queue{}); nil != err {
+		return nil, err
+	}
+	return &StormQueueStore{db: db}, nil
+}
+
+//Save inserts/updates ID and key of the queue in DB
+func (s *StormQueueStore) Save(q *Queue) error {
+	return s.db.Save(&Queue{ID: q.ID, Key: q.Key})
+}
+
+//Push appends events to the queue in DB
+func (s *StormQueueStore) Push(launchID string, events ...*Event) error {
+	tx, err := s.db.From(queuesBucket, launchID).Begin(true)
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+	for _, e := range events {
+		if err := tx.Set(eventsBucket, e.Seq, e); nil != err {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//Pop removes sent event from the queue in DB and updates IDs of the items
+func (s *StormQueueStore) Pop(launchID string, seq uint64, resolved map[string]string, finished ...string) error {
+	tx, err := s.db.From(queuesBucket, launchID).Begin(true)
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+	if err := tx.Delete(eventsBucket, seq); nil != err && storm.ErrNotFound != err {
+		return err
+	}
+	for id, rpID := range resolved {
+		if err := tx.Set(idsBucket, id, rpID); nil != err {
+			return err
+		}
+	}
+	for _, id := range finished {
+		if err := tx.Delete(idsBucket, id); nil != err && storm.ErrNotFound != err {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//Delete removes queue with all its events and IDs from DB
+func (s *StormQueueStore) Delete(id string) error {
+	tx, err := s.db.Begin(true)
+	if nil != err {
+		return err
+	}
+	defer tx.Rollback()
+	if err := tx.DeleteStruct(&Queue{ID: id}); nil != err && storm.ErrNotFound != err {
+		return err
+	}
+	if err := tx.From(queuesBucket).Drop(id); nil != err && bolt.ErrBucketNotFound != err {
+		return err
+	}
+	return tx.Commit()
+}
+
+//All loads all the pending queues with their events and IDs
+func (s *StormQueueStore) All() ([]*Queue, error) {
+	var queues []*Queue
+	if err := s.db.All(&queues); nil != err {
+		return nil, err
+	}
+	codec := s.db.Codec()
+	err := s.db.Bolt.View(func(tx *bolt.Tx) error {
+		for _, q := range queues {
+			q.IDs = map[string]string{}
+			node := s.db.From(queuesBucket, q.ID)
+			//keys are big-endian sequence numbers, so events are iterated in the order they are queued
+			if b := node.GetBucket(tx, eventsBucket); nil != b {
+				if err := b.ForEach(func(k, v []byte) error {
+					//nested buckets, e.g. storm metadata
+					if nil == v {
+						return nil
+					}
+					var e Event
+					if err := codec.Unmarshal(v, &e); nil != err {
+						return err
+					}
+					q.Events = append(q.Events, &e)
+					return nil
+				}); nil != err {
+					return err
+				}
+			}
+			if b := node.GetBucket(tx, idsBucket); nil != b {
+				if err := b.ForEach(func(k, v []byte) error {
+					if nil == v {
+						return nil
+					}
+					var rpID string
+					if err := codec.Unmarshal(v, &rpID); nil != err {
+						return err
+					}
+					q.IDs[string(k)] = rpID
+					return nil
+				}); nil != err {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return queues, err
+}
+
+//NewMemoryQueueStore creates new instance of MemoryQueueStore
+func NewMemoryQueueStore() *MemoryQueueStore {
+	return &MemoryQueueStore{queues: map[string]*Queue{}}
+}
+
+//Save inserts/updates ID and key of the queue
+func (s *MemoryQueueStore) Save(q *Queue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue(q.ID).Key = q.Key
+	return nil
+}
+
+//Push appends events to the queue
+func (s *MemoryQueueStore) Push(launchID string, events ...*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queue(launchID)
+	q.Events = append(q.Events, events...)
+	return nil
+}
+
+//Pop removes sent event from the queue and updates IDs of the items
+func (s *MemoryQueueStore) Pop(launchID string, seq uint64, resolved map[string]string, finished ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.queue(launchID)
+	for i, e := range q.Events {
+		if seq == e.Seq {
+			q.Events = append(q.Events[:i:i], q.Events[i+1:]...)
+			break
+		}
+	}
+	for id, rpID := range resolved {
+		q.IDs[id] = rpID
+	}
+	for _, id := range finished {
+		delete(q.IDs, id)
+	}
+	return nil
+}
+
+//Delete removes queue
+func (s *MemoryQueueStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.queues, id)
+	return nil
+}
+
+//All returns all the pending queues
+func (s *MemoryQueueStore) All() ([]*Queue, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queues := make([]*Queue, 0, len(s.queues))
+	for _, q := range s.queues {
+		queues = append(queues, q.copy())
+	}
+	return queues, nil
+}
+
+//queue returns queue of the launch creating it if it doesn't exist. Store is locked by the caller
+func (s *MemoryQueueStore) queue(launchID string) *Queue {
+	q, ok := s.queues[launchID]
+	if !ok {
+		q = &Queue{ID: launchID, IDs: map[string]string{}}
+		s.queues[launchID] = q
+	}
+	return q
+}
+
+//copy makes a snapshot of the queue which is safe to be read while queue is being changed
+func (q *Queue) copy() *Queue {
+	c := &Queue{
+		ID:     q.ID,
+		Key:    q.Key,
+		Events: make([]*Event, len(q.Events)),
+		IDs:    make(map[string]string, len(q.IDs)),
+	}
+	copy(c.Events, q.Events)
+	for k, v := range q.IDs {
+		c.IDs[k] = v
+	}
+	return c
+}
+
+//newID generates temporary item ID
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); nil != err {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
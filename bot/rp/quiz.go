@@ -0,0 +1,167 @@
+package rp
+
+import (
+	"context"
+	"fmt"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"github.com/avarabyeu/rpquiz/bot/reporting"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+//QuizReporter reports quizzes to ReportPortal: quiz is a launch with a suite per question category, each question is a test.
+//If launch is shared, all the quizzes of the event are reported to a single launch with a suite per user.
+//IDs of the RP items are kept in the session
+type QuizReporter struct {
+	rp *Reporter
+	//SharedLaunch enables reporting all the quizzes of the event into one launch
+	SharedLaunch bool
+	//ReportRemaining enables reporting questions which haven't been asked as skipped once quiz is aborted
+	ReportRemaining bool
+	//Defects classifies wrong answers and skipped questions
+	Defects *Defects
+}
+
+//NewQuizReporter creates new instance of QuizReporter
+func NewQuizReporter(rp *Reporter) *QuizReporter {
+	return &QuizReporter{rp: rp, Defects: NewDefects()}
+}
+
+//QuizStarted starts launch. If launch is shared, starts suite of the user in the launch of the event
+func (r *QuizReporter) QuizStarted(ctx context.Context, s *db.QuizSession) {
+	userName := botctx.GetUserName(ctx)
+	event := botctx.GetEvent(ctx)
+	attrs := map[string]string{
+		"user":    userName,
+		"channel": botctx.GetChannel(ctx),
+		"event":   event,
+	}
+	if "" != s.Quiz {
+		attrs["quiz"] = s.Quiz
+	}
+	if "" != s.Referral {
+		attrs["referral"] = s.Referral
+	}
+	s.Suites = map[string]string{}
+
+	if !r.SharedLaunch {
+		s.LaunchID = r.rp.StartLaunch(ctx, fmt.Sprintf("SEC-RP-quiz: %s", userName), attrs)
+		s.SuiteID = ""
+		return
+	}
+
+	name := "SEC-RP-quiz"
+	if "" != event {
+		name = fmt.Sprintf("SEC-RP-quiz: %s", event)
+	}
+	s.LaunchID = r.rp.SharedLaunch(ctx, event, name, map[string]string{"event": event})
+	s.SuiteID = r.rp.StartSuite(ctx, s.LaunchID, "", userName, attrs)
+}
+
+//QuestionAsked starts test for the question and attaches options shown to the user
+func (r *QuizReporter) QuestionAsked(ctx context.Context, s *db.QuizSession, q int, options []string) {
+	s.TestID = r.startQuestion(ctx, s, s.Questions[q])
+	r.rp.Log(ctx, s.LaunchID, s.TestID, LevelInfo, fmt.Sprintf("Options: %s", strings.Join(options, " | ")))
+}
+
+//QuestionAnswered attaches answer details to the test and finishes it
+func (r *QuizReporter) QuestionAnswered(ctx context.Context, s *db.QuizSession, q int, answer string, passed bool) {
+	correctAnswer, _ := url.PathUnescape(s.Questions[q].CorrectAnswer)
+
+	answerLevel := LevelInfo
+	if !passed {
+		answerLevel = LevelError
+	}
+	r.rp.Log(ctx, s.LaunchID, s.TestID, answerLevel, fmt.Sprintf("Answer: %s", answer))
+	r.rp.Log(ctx, s.LaunchID, s.TestID, LevelInfo, fmt.Sprintf("Correct answer: %s", strings.TrimSpace(correctAnswer)))
+	if !s.QuestionAskedAt.IsZero() {
+		r.rp.Log(ctx, s.LaunchID, s.TestID, LevelInfo,
+			fmt.Sprintf("Response time: %s", time.Since(s.QuestionAskedAt).Round(time.Millisecond)))
+	}
+	if passed {
+		r.rp.FinishTest(ctx, s.LaunchID, s.TestID, true)
+		return
+	}
+	r.rp.FailTest(ctx, s.LaunchID, s.TestID, r.Defects.ForAnswer(s.Questions[q].Category),
+		fmt.Sprintf("Wrong answer '%s'. Correct answer is '%s'", answer, strings.TrimSpace(correctAnswer)))
+}
+
+//QuizFinished finishes the launch with the score
+func (r *QuizReporter) QuizFinished(ctx context.Context, s *db.QuizSession) {
+	r.finish(ctx, s)
+}
+
+//QuizAborted skips the question being answered and, if enabled, the remaining questions. Finishes the launch with the score
+func (r *QuizReporter) QuizAborted(ctx context.Context, s *db.QuizSession, reason string) {
+	if "" == s.LaunchID {
+		return
+	}
+	comment := fmt.Sprintf("Quiz %s", reason)
+	issueType := r.Defects.ForAbort(reason)
+
+	//questions are asked one by one, so the question being answered is the one after the last answered
+	pending := len(s.Results)
+	if "" != s.TestID && pending < len(s.Questions) {
+		r.rp.SkipTest(ctx, s.LaunchID, s.TestID, issueType, comment)
+		pending++
+	}
+	if r.ReportRemaining {
+		for i := pending; i < len(s.Questions); i++ {
+			testID := r.startQuestion(ctx, s, s.Questions[i])
+			r.rp.SkipTest(ctx, s.LaunchID, testID, issueType, comment)
+		}
+	}
+	r.finish(ctx, s)
+}
+
+//finish finishes category suites and launch. If launch is shared, finishes suite of the user instead of launch
+func (r *QuizReporter) finish(ctx context.Context, s *db.QuizSession) {
+	if "" == s.LaunchID {
+		return
+	}
+	categories := make([]string, 0, len(s.Suites))
+	for category := range s.Suites {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		r.rp.FinishSuite(ctx, s.LaunchID, s.Suites[category], "")
+	}
+
+	score := fmt.Sprintf("Score: %d/%d", reporting.Score(s), len(s.Questions))
+	if "" != s.SuiteID {
+		r.rp.FinishSuite(ctx, s.LaunchID, s.SuiteID, score)
+		return
+	}
+	r.rp.FinishLaunch(ctx, s.LaunchID, score)
+}
+
+//startQuestion starts test of the question in the suite of its category
+func (r *QuizReporter) startQuestion(ctx context.Context, s *db.QuizSession, question *opentdb.Question) string {
+	name, _ := url.PathUnescape(question.Question)
+	return r.rp.StartTest(ctx, s.LaunchID, r.categorySuite(ctx, s, question.Category), name, map[string]string{
+		"category":   strings.TrimSpace(question.Category),
+		"difficulty": strings.TrimSpace(question.Difficulty),
+	})
+}
+
+//categorySuite returns suite of the question category. Suite is started if it isn't started yet
+func (r *QuizReporter) categorySuite(ctx context.Context, s *db.QuizSession, category string) string {
+	category = strings.TrimSpace(category)
+	if "" == category {
+		category = "Uncategorized"
+	}
+	if nil == s.Suites {
+		s.Suites = map[string]string{}
+	}
+	if suiteID, ok := s.Suites[category]; ok {
+		return suiteID
+	}
+	suiteID := r.rp.StartSuite(ctx, s.LaunchID, s.SuiteID, category, nil)
+	s.Suites[category] = suiteID
+	return suiteID
+}
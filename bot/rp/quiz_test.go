@@ -0,0 +1,99 @@
+package rp
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/opentdb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestQuizReporterSharedLaunch(t *testing.T) {
+	fake := &fakeRP{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store := NewMemoryQueueStore()
+	r := NewQuizReporter(newTestReporter(srv.URL, store))
+	r.SharedLaunch = true
+
+	for _, user := range []string{"john", "jane"} {
+		ctx := botctx.WithEvent(botctx.WithUserName(context.Background(), user), "conf")
+		s := &db.QuizSession{ID: user, Results: map[int]bool{}, Questions: []*opentdb.Question{
+			{Category: "Animals", Question: "Are cats cute?", CorrectAnswer: "True"},
+			{Category: "Science", Question: "2+2", CorrectAnswer: "4"},
+			{Category: "Animals", Question: "Are dogs cute?", CorrectAnswer: "True"},
+		}}
+		r.QuizStarted(ctx, s)
+		for i := range s.Questions {
+			r.QuestionAsked(ctx, s, i, []string{"True", "False"})
+			s.Results[i] = true
+			r.QuestionAnswered(ctx, s, i, "True", true)
+		}
+		r.QuizFinished(ctx, s)
+	}
+	r.rp.FinishSharedLaunch(context.Background(), "conf")
+	waitUntilSent(t, store)
+
+	var launches, suites, finishedLaunches int
+	for _, c := range fake.Calls() {
+		switch {
+		case http.MethodPost == c.Method && strings.HasSuffix(c.Path, "/launch"):
+			launches++
+		case http.MethodPost == c.Method && "SUITE" == c.Body["type"]:
+			suites++
+		case http.MethodPut == c.Method && strings.Contains(c.Path, "/launch/"):
+			finishedLaunches++
+		}
+	}
+	if 1 != launches || 1 != finishedLaunches {
+		t.Errorf("Expected one shared launch. Started: %d, finished: %d", launches, finishedLaunches)
+	}
+	//suite per user and suite per category of each user
+	if 6 != suites {
+		t.Errorf("Expected 6 suites, got %d", suites)
+	}
+}
+
+func TestQuizReporterAbort(t *testing.T) {
+	fake := &fakeRP{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store := NewMemoryQueueStore()
+	r := NewQuizReporter(newTestReporter(srv.URL, store))
+	r.ReportRemaining = true
+
+	ctx := botctx.WithUserName(context.Background(), "john")
+	s := &db.QuizSession{ID: "john", Results: map[int]bool{}, Questions: []*opentdb.Question{
+		{Category: "Animals", Question: "Are cats cute?", CorrectAnswer: "True"},
+		{Category: "Science", Question: "2+2", CorrectAnswer: "4"},
+		{Category: "Animals", Question: "Are dogs cute?", CorrectAnswer: "True"},
+	}}
+	r.QuizStarted(ctx, s)
+	r.QuestionAsked(ctx, s, 0, []string{"True", "False"})
+	s.Results[0] = true
+	r.QuestionAnswered(ctx, s, 0, "True", true)
+	r.QuestionAsked(ctx, s, 1, []string{"4", "5"})
+	r.QuizAborted(ctx, s, "user aborted")
+	waitUntilSent(t, store)
+
+	var skipped int
+	for _, c := range fake.Calls() {
+		if http.MethodPut != c.Method || StatusSkipped != c.Body["status"] {
+			continue
+		}
+		skipped++
+		issue, _ := c.Body["issue"].(map[string]interface{})
+		if IssueNoDefect != issue["issue_type"] || "Quiz user aborted" != issue["comment"] {
+			t.Errorf("Unexpected issue of skipped test: %v", c.Body["issue"])
+		}
+	}
+	//question being answered and the remaining one
+	if 2 != skipped {
+		t.Errorf("Expected 2 skipped tests, got %d", skipped)
+	}
+}
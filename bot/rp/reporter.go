@@ -1,162 +1,549 @@
 package rp
 
 import (
-	"fmt"
+	"context"
 	"github.com/apex/log"
-	"github.com/avarabyeu/gorp/gorp"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"github.com/pkg/errors"
+	"sort"
+	"sync"
 	"time"
 )
 
+const (
+	//LevelInfo is a level of informational log entries
+	LevelInfo = "INFO"
+	//LevelError is a level of log entries describing failures
+	LevelError = "ERROR"
+
+	//StatusSkipped is a status of tests which haven't been executed
+	StatusSkipped = "SKIPPED"
+	//StatusFailed is a status of failed tests
+	StatusFailed = "FAILED"
+)
+
+var (
+	errStopped    = errors.New("reporter is stopped")
+	errUnresolved = errors.New("item hasn't been created in RP")
+)
+
+//Client is a subset of ReportPortal client API used by the Reporter
+type Client interface {
+	StartLaunch(rq *StartLaunchRQ) (*EntryCreatedRS, error)
+	FinishLaunch(id string, rq *FinishExecutionRQ) (*FinishLaunchRS, error)
+	StopLaunch(id string) (*MsgRS, error)
+	StartTest(rq *StartTestRQ) (*EntryCreatedRS, error)
+	StartChildTest(parent string, rq *StartTestRQ) (*EntryCreatedRS, error)
+	FinishTest(id string, rq *FinishTestRQ) (*MsgRS, error)
+	SaveLog(rq *SaveLogRQ) (*EntryCreatedRS, error)
+}
+
+//Reporter reports quiz results to ReportPortal.
+//Operations are queued per launch and sent one by one in the order they have been reported.
+//Callers get temporary item IDs which are resolved to real RP IDs once items are created
+type Reporter struct {
+	rp    Client
+	store QueueStore
+
+	//Attempts is a number of attempts to send an event before it's dropped
+	Attempts int
+	//Backoff is a delay before the first retry. Doubled on each next retry
+	Backoff time.Duration
+	//MaxBackoff limits delay between retries
+	MaxBackoff time.Duration
+
+	mu      sync.Mutex
+	queues  map[string]*launchQueue
+	shared  map[string]string
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	stopped bool
+}
+
+//launchQueue is an in-memory state of the launch queue
+type launchQueue struct {
+	mu sync.Mutex
+	*Queue
+	//seq is a sequence number of the last queued event
+	seq     uint64
+	running bool
+}
+
 //NewReporter creates new instance of Reporter
-func NewReporter(client *gorp.Client) *Reporter {
+func NewReporter(client Client, store QueueStore) *Reporter {
 	return &Reporter{
-		rp: client,
+		rp:         client,
+		store:      store,
+		Attempts:   8,
+		Backoff:    time.Second,
+		MaxBackoff: time.Minute,
+		queues:     map[string]*launchQueue{},
+		shared:     map[string]string{},
+		stop:       make(chan struct{}),
 	}
 }
 
-//Reporter simple wrapper over RP client
-type Reporter struct {
-	rp *gorp.Client
+//StartLaunch starts launch in RP. Returns temporary ID of the launch
+func (r *Reporter) StartLaunch(ctx context.Context, name string, attrs map[string]string) string {
+	launchID := newID()
+	r.enqueue(ctx, launchID, &Event{Type: eventStartLaunch, ItemID: launchID, Name: name, Time: time.Now(), Attributes: attrs})
+	return launchID
 }
 
-//StartTest starts new test in RP
-func (r *Reporter) StartTest(launchID, sID, question string, callback func(string, error)) {
-	go func() {
-		log.Debug("Reporting new question to RP")
+//SharedLaunch returns launch shared by everyone reporting with the same key. Launch is started if it isn't started yet.
+//Shared launches survive restarts and stay in progress until FinishSharedLaunch is called, e.g. once the event is over
+func (r *Reporter) SharedLaunch(ctx context.Context, key, name string, attrs map[string]string) string {
+	r.mu.Lock()
+	if launchID, ok := r.shared[key]; ok {
+		r.mu.Unlock()
+		return launchID
+	}
 
-		rs, err := r.rp.StartChildTest(sID, &gorp.StartTestRQ{
-			LaunchID: launchID,
-			Type:     "step",
-			StartRQ: gorp.StartRQ{
-				StartTime: gorp.Timestamp{Time: time.Now()},
-				Name:      question,
-			}})
-		if nil != err {
-			callback("", err)
-		}
-		callback(rs.ID, nil)
-	}()
+	//launch is queued under the lock so concurrent callers with the same key get the same launch
+	launchID := newID()
+	q := &launchQueue{Queue: &Queue{ID: launchID, Key: key, IDs: map[string]string{}}}
+	r.queues[launchID] = q
+	r.shared[key] = launchID
+
+	q.mu.Lock()
+	if err := r.push(q, true, &Event{Type: eventStartLaunch, ItemID: launchID, Name: name, Time: time.Now(), Attributes: attrs}); nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot persist RP events")
+	}
+	q.mu.Unlock()
+	r.mu.Unlock()
+
+	r.run(q)
+	return launchID
+}
+
+//FinishSharedLaunch finishes launch shared with the given key. Returns false if there is no such launch
+func (r *Reporter) FinishSharedLaunch(ctx context.Context, key string) bool {
+	r.mu.Lock()
+	launchID, ok := r.shared[key]
+	delete(r.shared, key)
+	r.mu.Unlock()
+
+	if ok {
+		tracing.Logger(ctx).Infof("Finishing shared launch %s", key)
+		r.FinishLaunch(ctx, launchID, "")
+	}
+	return ok
+}
+
+//SharedLaunches returns keys of the shared launches in progress
+func (r *Reporter) SharedLaunches() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.shared))
+	for key := range r.shared {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//StartSuite starts new suite under the given parent item or under the launch if parent is empty. Returns temporary ID of the suite
+func (r *Reporter) StartSuite(ctx context.Context, launchID, parentID, name string, attrs map[string]string) string {
+	return r.startItem(ctx, launchID, parentID, "SUITE", name, attrs)
+}
+
+//StartTest starts new test under the given parent item. Returns temporary ID of the test
+func (r *Reporter) StartTest(ctx context.Context, launchID, parentID, name string, attrs map[string]string) string {
+	return r.startItem(ctx, launchID, parentID, "STEP", name, attrs)
+}
 
+func (r *Reporter) startItem(ctx context.Context, launchID, parentID, itemType, name string, attrs map[string]string) string {
+	itemID := newID()
+	r.enqueue(ctx, launchID, &Event{
+		Type:       eventStartTest,
+		ItemID:     itemID,
+		ParentID:   parentID,
+		ItemType:   itemType,
+		Name:       name,
+		Time:       time.Now(),
+		Attributes: attrs,
+	})
+	return itemID
+}
+
+//Log attaches log entry to the item
+func (r *Reporter) Log(ctx context.Context, launchID, itemID, level, message string) {
+	r.enqueue(ctx, launchID, &Event{Type: eventLog, ItemID: itemID, Level: level, Message: message, Time: time.Now()})
 }
 
 //FinishTest finishes test in RP
-func (r *Reporter) FinishTest(testID string, pass bool, callback func(error)) {
-	go func() {
-		log.Debugf("Finishing test %s in RP", testID)
+func (r *Reporter) FinishTest(ctx context.Context, launchID, testID string, pass bool) {
+	r.enqueue(ctx, launchID, &Event{Type: eventFinishTest, ItemID: testID, Status: asStatus(pass), Time: time.Now()})
+}
 
-		_, err := r.rp.FinishTest(testID, &gorp.FinishTestRQ{
-			FinishExecutionRQ: gorp.FinishExecutionRQ{
-				Status:  asStatus(pass),
-				EndTime: gorp.Timestamp{Time: time.Now()},
-			},
-		})
-		callback(err)
-	}()
+//SkipTest finishes test in RP as SKIPPED with the given issue
+func (r *Reporter) SkipTest(ctx context.Context, launchID, testID, issueType, comment string) {
+	r.finishWithIssue(ctx, launchID, testID, StatusSkipped, issueType, comment)
+}
+
+//FailTest finishes test in RP as FAILED with the given issue
+func (r *Reporter) FailTest(ctx context.Context, launchID, testID, issueType, comment string) {
+	r.finishWithIssue(ctx, launchID, testID, StatusFailed, issueType, comment)
+}
+
+func (r *Reporter) finishWithIssue(ctx context.Context, launchID, testID, status, issueType, comment string) {
+	r.enqueue(ctx, launchID, &Event{
+		Type:         eventFinishTest,
+		ItemID:       testID,
+		Status:       status,
+		Time:         time.Now(),
+		IssueType:    issueType,
+		IssueComment: comment,
+	})
+}
+
+//FinishSuite finishes suite in RP. Status is calculated by RP from the children. Description summarizes the suite
+func (r *Reporter) FinishSuite(ctx context.Context, launchID, suiteID, description string) {
+	r.enqueue(ctx, launchID, &Event{Type: eventFinishTest, ItemID: suiteID, Time: time.Now(), Description: description})
+}
+
+//FinishLaunch finishes launch in RP. Description summarizes the launch
+func (r *Reporter) FinishLaunch(ctx context.Context, launchID, description string) {
+	r.mu.Lock()
+	q, ok := r.queues[launchID]
+	r.mu.Unlock()
+	if ok && "" != q.Key {
+		//launch isn't shared anymore, so it isn't resumed as shared after restart
+		q.mu.Lock()
+		q.Key = ""
+		if err := r.store.Save(q.Queue); nil != err {
+			tracing.Logger(ctx).WithError(err).Error("Cannot persist RP events")
+		}
+		q.mu.Unlock()
+	}
+	r.enqueue(ctx, launchID, &Event{Type: eventFinishLaunch, ItemID: launchID, Time: time.Now(), Description: description})
+}
 
+//Resume loads events persisted before restart and starts sending them
+func (r *Reporter) Resume() error {
+	queues, err := r.store.All()
+	if nil != err {
+		return err
+	}
+	for _, q := range queues {
+		log.Infof("Resuming %d pending RP events of launch %s", len(q.Events), q.ID)
+		if nil == q.IDs {
+			q.IDs = map[string]string{}
+		}
+		lq := &launchQueue{Queue: q}
+		if 0 != len(q.Events) {
+			lq.seq = q.Events[len(q.Events)-1].Seq
+		}
+
+		r.mu.Lock()
+		r.queues[q.ID] = lq
+		if "" != q.Key {
+			r.shared[q.Key] = q.ID
+		}
+		r.mu.Unlock()
+
+		r.run(lq)
+	}
+	return nil
 }
 
-//StartLaunch starts launch in report portal
-func (r *Reporter) StartLaunch(name string, callback func(string, string, error) error) {
+//Stop stops sending events and waits until in-flight events are sent.
+//Pending events stay persisted and are sent after restart
+func (r *Reporter) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
 	go func() {
-		log.Debug("Starting launch in RP")
-		rs, err := r.rp.StartLaunch(&gorp.StartLaunchRQ{
-			StartRQ: gorp.StartRQ{
-				Name: name,
-				//Description: "test desc",
-				StartTime: gorp.Timestamp{Time: time.Now()},
-			},
-		})
-		if err != nil {
-			log.WithError(err).Error("Cannot start launch in rp")
-			callback("", "", err)
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//enqueue persists events and makes sure they are being sent
+func (r *Reporter) enqueue(ctx context.Context, launchID string, events ...*Event) {
+	r.mu.Lock()
+	q, ok := r.queues[launchID]
+	if !ok {
+		q = &launchQueue{Queue: &Queue{ID: launchID, IDs: map[string]string{}}}
+		r.queues[launchID] = q
+	}
+	r.mu.Unlock()
+
+	q.mu.Lock()
+	if err := r.push(q, !ok, events...); nil != err {
+		tracing.Logger(ctx).WithError(err).Error("Cannot persist RP events")
+	}
+	q.mu.Unlock()
+
+	tracing.Logger(ctx).Debugf("%d RP events of launch %s are queued", len(events), launchID)
+	r.run(q)
+}
+
+//push appends events to the queue and persists them. New queue is persisted first. Queue is locked by the caller
+func (r *Reporter) push(q *launchQueue, isNew bool, events ...*Event) error {
+	for _, e := range events {
+		q.seq++
+		e.Seq = q.seq
+	}
+	q.Events = append(q.Events, events...)
+	if isNew {
+		if err := r.store.Save(q.Queue); nil != err {
+			return err
+		}
+	}
+	return r.store.Push(q.ID, events...)
+}
+
+//run starts sending events of the queue unless it's already being sent
+func (r *Reporter) run(q *launchQueue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running {
+		return
+	}
+	q.running = true
+
+	r.wg.Add(1)
+	go r.drain(q)
+}
+
+//drain sends events of the queue one by one until queue is empty
+func (r *Reporter) drain(q *launchQueue) {
+	defer r.wg.Done()
+	logger := log.WithField("launch", q.ID)
+
+	for {
+		q.mu.Lock()
+		//once reporter is stopped, pending events stay persisted and are sent after restart
+		if 0 == len(q.Events) || r.isStopped() {
+			q.running = false
+			q.mu.Unlock()
 			return
 		}
+		e := q.Events[0]
+		q.mu.Unlock()
 
-		sRS, err := r.rp.StartTest(&gorp.StartTestRQ{
-			LaunchID: rs.ID,
-			Type:     "SUITE",
-			StartRQ: gorp.StartRQ{
-				StartTime: gorp.Timestamp{Time: time.Now()},
-				Name:      name,
-			},
-		})
-		if err != nil {
-			log.WithError(err).Error("Cannot start launch in rp")
-			callback("", "", err)
+		rpID, err := r.sendWithRetry(q, e, logger)
+		if errStopped == err {
+			q.mu.Lock()
+			q.running = false
+			q.mu.Unlock()
 			return
 		}
+		if nil != err {
+			logger.WithError(err).Errorf("Cannot send %s event to RP. Event is dropped", e.Type)
+		}
 
-		callback(rs.ID, sRS.ID, nil)
-	}()
+		q.mu.Lock()
+		q.Events = q.Events[1:]
+		resolved := map[string]string{}
+		if "" != rpID {
+			q.IDs[e.ItemID] = rpID
+			resolved[e.ItemID] = rpID
+		}
+		var finished []string
+		if eventFinishTest == e.Type {
+			//finished item isn't referenced anymore
+			delete(q.IDs, e.ItemID)
+			finished = append(finished, e.ItemID)
+		}
+		over := eventFinishLaunch == e.Type && 0 == len(q.Events)
+		if over {
+			err = r.store.Delete(q.ID)
+		} else {
+			err = r.store.Pop(q.ID, e.Seq, resolved, finished...)
+		}
+		q.mu.Unlock()
+		if nil != err {
+			logger.WithError(err).Error("Cannot persist RP events")
+		}
 
+		if over {
+			r.mu.Lock()
+			delete(r.queues, q.ID)
+			r.mu.Unlock()
+		}
+	}
 }
 
-//FinishLaunch finishes launch in ReportPortal
-func (r *Reporter) FinishLaunch(rpID, sID string, needRetry bool, callback func(error)) {
-	go func() {
-		//due to RP constant that all child items should be finished,
-		//we use retry here.
-		//since reporting is implemented in async fashion, not all items
-		//may be finished at the time when launch finish is triggered
-
-		var err error
-
-		// finish can be retried if needed (to make sure all children are finished)
-		if needRetry {
-
-			//retry finishing of root test suite
-			_, err = retry(5, 3*time.Second, func() (interface{}, error) {
-				return r.rp.FinishTest(sID, &gorp.FinishTestRQ{
-					FinishExecutionRQ: gorp.FinishExecutionRQ{
-						EndTime: gorp.Timestamp{Time: time.Now()},
-					},
-				})
-			})
-
-			//if finished successfully, finish launch
-			if nil == err {
-				_, err = retry(5, 3*time.Second, func() (interface{}, error) {
-					return r.finishLaunchInternally(rpID)
-				})
+//isStopped checks whether reporter is stopped
+func (r *Reporter) isStopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+//sendWithRetry sends event to RP retrying with exponential backoff
+func (r *Reporter) sendWithRetry(q *launchQueue, e *Event, logger log.Interface) (string, error) {
+	backoff := r.Backoff
+	for attempt := 1; ; attempt++ {
+		rpID, err := r.send(q, e)
+		if nil == err || errUnresolved == errors.Cause(err) || attempt >= r.Attempts {
+			if nil != err && eventFinishLaunch == e.Type {
+				//launch cannot be finished. Force stop it to avoid hanging in progress
+				logger.Warnf("Cannot finish launch %s. Forcing stop...", q.ID)
+				err = r.forceStop(q)
 			}
+			return rpID, err
+		}
 
-		} else {
-			//finish without retries
-			_, err = r.finishLaunchInternally(rpID)
+		logger.WithError(err).Warnf("Cannot send %s event to RP. Retrying in %s. Attempt: %d. Left: %d",
+			e.Type, backoff, attempt, r.Attempts-attempt)
+		select {
+		case <-time.After(backoff):
+		case <-r.stop:
+			return "", errStopped
+		}
+		if backoff *= 2; backoff > r.MaxBackoff {
+			backoff = r.MaxBackoff
+		}
+	}
+}
+
+//send sends single event to RP. Returns real ID of the item, if it has been created
+func (r *Reporter) send(q *launchQueue, e *Event) (rpID string, err error) {
+	_, span := tracing.StartSpan(context.Background(), "rp."+e.Type)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	switch e.Type {
+	case eventStartLaunch:
+		var rs *EntryCreatedRS
+		if rs, err = r.rp.StartLaunch(&StartLaunchRQ{
+			StartRQ: StartRQ{
+				Name:      e.Name,
+				StartTime: Timestamp{Time: e.Time},
+				Tags:      asTags(e.Attributes),
+			},
+		}); nil != err {
+			return "", err
+		}
+		return rs.ID, nil
+
+	case eventStartTest:
+		var launchID, parentID string
+		if launchID, err = q.resolve(q.ID); nil != err {
+			return "", err
+		}
+		rq := &StartTestRQ{
+			LaunchID: launchID,
+			Type:     e.ItemType,
+			StartRQ: StartRQ{
+				Name:      e.Name,
+				StartTime: Timestamp{Time: e.Time},
+				Tags:      asTags(e.Attributes),
+			},
 		}
 
-		//if finish haven't passed successfully, ЖЕСТАЧАЙШЕ execute force finish
+		var rs *EntryCreatedRS
+		if "" == e.ParentID {
+			rs, err = r.rp.StartTest(rq)
+		} else if parentID, err = q.resolve(e.ParentID); nil == err {
+			rs, err = r.rp.StartChildTest(parentID, rq)
+		}
 		if nil != err {
-			log.Warnf("Cannot finish launch %s. Forcing stop...", rpID)
-			_, err = r.rp.StopLaunch(rpID)
+			return "", err
 		}
-		callback(err)
-	}()
+		return rs.ID, nil
+
+	case eventFinishTest:
+		var testID string
+		if testID, err = q.resolve(e.ItemID); nil != err {
+			return "", err
+		}
+		rq := &FinishTestRQ{
+			FinishExecutionRQ: FinishExecutionRQ{
+				Status:      e.Status,
+				EndTime:     Timestamp{Time: e.Time},
+				Description: e.Description,
+			},
+		}
+		if "" != e.IssueType {
+			rq.Issue = &Issue{IssueType: e.IssueType, Comment: e.IssueComment}
+		}
+		_, err = r.rp.FinishTest(testID, rq)
+		return "", err
+
+	case eventFinishLaunch:
+		var launchID string
+		if launchID, err = q.resolve(q.ID); nil != err {
+			return "", err
+		}
+		_, err = r.rp.FinishLaunch(launchID, &FinishExecutionRQ{
+			EndTime:     Timestamp{Time: e.Time},
+			Description: e.Description,
+		})
+		return "", err
+
+	case eventLog:
+		var itemID string
+		if itemID, err = q.resolve(e.ItemID); nil != err {
+			return "", err
+		}
+		_, err = r.rp.SaveLog(&SaveLogRQ{
+			ItemID:  itemID,
+			LogTime: Timestamp{Time: e.Time},
+			Message: e.Message,
+			Level:   e.Level,
+		})
+		return "", err
+	}
+	return "", errors.Errorf("unknown event type: %s", e.Type)
 }
 
-func (r *Reporter) finishLaunchInternally(rpID string) (interface{}, error) {
-	return r.rp.FinishLaunch(rpID, &gorp.FinishExecutionRQ{
-		EndTime: gorp.Timestamp{
-			Time: time.Now(),
-		},
-		//Status: "PASSED",
-	})
+func (r *Reporter) forceStop(q *launchQueue) error {
+	launchID, err := q.resolve(q.ID)
+	if nil != err {
+		return err
+	}
+	_, err = r.rp.StopLaunch(launchID)
+	return err
 }
 
-//retry executes callback func until it executes successfully
-func retry(attempts int, timeout time.Duration, callback func() (interface{}, error)) (interface{}, error) {
-	var err error
-	for i := 0; i < attempts; i++ {
-		var res interface{}
-		res, err = callback()
-		if err == nil {
-			return res, nil
-		}
+//resolve converts temporary item ID to real RP ID
+func (q *launchQueue) resolve(id string) (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rpID, ok := q.IDs[id]
+	if !ok {
+		return "", errors.Wrapf(errUnresolved, "item %s", id)
+	}
+	return rpID, nil
+}
 
-		<-time.After(timeout)
-		log.Infof("Retrying... Attempt: %d. Left: %d", i+1, attempts-1-i)
+//asTags converts attributes to RP tags in key:value format
+func asTags(attrs map[string]string) []string {
+	if 0 == len(attrs) {
+		return nil
 	}
-	return nil, fmt.Errorf("after %d attempts, last error: %s", attempts, err)
+	tags := make([]string, 0, len(attrs))
+	for k, v := range attrs {
+		if "" != v {
+			tags = append(tags, k+":"+v)
+		}
+	}
+	sort.Strings(tags)
+	return tags
 }
 
 func asStatus(pass bool) string {
@@ -170,7 +557,3 @@ func asStatus(pass bool) string {
 
 	return status
 }
-
-func boolPtr(b bool) *bool {
-	return &b
-}
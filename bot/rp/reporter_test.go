@@ -0,0 +1,331 @@
+package rp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/asdine/storm/v3"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//call is a request received by fake ReportPortal
+type call struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+	ID     string
+}
+
+//fakeRP is a fake ReportPortal server which creates items with sequential IDs
+type fakeRP struct {
+	mu    sync.Mutex
+	calls []*call
+}
+
+func (f *fakeRP) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
+	//random latency makes possible races visible
+	time.Sleep(time.Duration(rand.Intn(5)) * time.Millisecond)
+
+	c := &call{Method: rq.Method, Path: rq.URL.Path}
+	if err := json.NewDecoder(rq.Body).Decode(&c.Body); nil != err {
+		c.Body = map[string]interface{}{}
+	}
+
+	f.mu.Lock()
+	if http.MethodPost == rq.Method {
+		c.ID = fmt.Sprintf("rp-%d", len(f.calls)+1)
+	}
+	f.calls = append(f.calls, c)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if "" != c.ID {
+		json.NewEncoder(w).Encode(map[string]string{"id": c.ID})
+	} else {
+		json.NewEncoder(w).Encode(map[string]string{"msg": "ok"})
+	}
+}
+
+func (f *fakeRP) Calls() []*call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*call{}, f.calls...)
+}
+
+func TestReporterOrder(t *testing.T) {
+	fake := &fakeRP{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	store := NewMemoryQueueStore()
+	r := newTestReporter(srv.URL, store)
+	reportQuiz(r)
+
+	waitUntilSent(t, store)
+	verifyCalls(t, fake.Calls())
+}
+
+func TestReporterResumesAfterRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpquiz")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bdb, err := storm.Open(filepath.Join(dir, "test.db"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	store, err := NewStormQueueStore(bdb)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	//ReportPortal is down
+	down := httptest.NewServer(&fakeRP{})
+	down.Close()
+
+	r := newTestReporter(down.URL, store)
+	reportQuiz(r)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Stop(ctx); nil != err {
+		t.Fatalf("Cannot stop reporter: %s", err)
+	}
+
+	queues, err := store.All()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(queues) || 10 != len(queues[0].Events) {
+		t.Fatalf("Expected all the events to be persisted. Got: %v", queues)
+	}
+
+	//ReportPortal is up again
+	fake := &fakeRP{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	r = newTestReporter(srv.URL, store)
+	if err := r.Resume(); nil != err {
+		t.Fatal(err)
+	}
+
+	waitUntilSent(t, store)
+	verifyCalls(t, fake.Calls())
+}
+
+func TestSharedLaunchSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpquiz")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bdb, err := storm.Open(filepath.Join(dir, "test.db"))
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	store, err := NewStormQueueStore(bdb)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	fake := &fakeRP{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ctx := context.Background()
+	r := newTestReporter(srv.URL, store)
+	launchID := r.SharedLaunch(ctx, "conf", "quiz", nil)
+	suiteID := r.StartSuite(ctx, launchID, "", "john", nil)
+	testID := r.StartTest(ctx, launchID, suiteID, "question", nil)
+	r.FinishTest(ctx, launchID, testID, true)
+	r.FinishSuite(ctx, launchID, suiteID, "")
+
+	queue := waitUntilDrained(t, store)
+	//only launch is referenced once its items are finished
+	if "conf" != queue.Key || 1 != len(queue.IDs) || "" == queue.IDs[launchID] {
+		t.Errorf("Expected IDs of the finished items to be removed, got %v", queue.IDs)
+	}
+
+	//restart keeps shared launch in progress
+	stopCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := r.Stop(stopCtx); nil != err {
+		t.Fatalf("Cannot stop reporter: %s", err)
+	}
+	r = newTestReporter(srv.URL, store)
+	if err := r.Resume(); nil != err {
+		t.Fatal(err)
+	}
+	if resumed := r.SharedLaunch(ctx, "conf", "quiz", nil); launchID != resumed {
+		t.Errorf("Expected launch %s to be resumed, got %s", launchID, resumed)
+	}
+	r.FinishSuite(ctx, launchID, r.StartSuite(ctx, launchID, "", "jane", nil), "")
+
+	//event is over
+	rs := httptest.NewRecorder()
+	FinishLaunchesHandler(r).ServeHTTP(rs, httptest.NewRequest(http.MethodPost, "/api/v1/rp/launches/finish?event=conf", nil))
+	if http.StatusOK != rs.Code || !strings.Contains(rs.Body.String(), `"conf"`) {
+		t.Errorf("Expected launch to be finished, got %d %s", rs.Code, rs.Body)
+	}
+	waitUntilSent(t, store)
+
+	var launches, finishedLaunches int
+	for _, c := range fake.Calls() {
+		switch {
+		case http.MethodPost == c.Method && strings.HasSuffix(c.Path, "/launch"):
+			launches++
+		case http.MethodPut == c.Method && strings.Contains(c.Path, "/launch/"):
+			finishedLaunches++
+		}
+	}
+	if 1 != launches || 1 != finishedLaunches {
+		t.Errorf("Expected one shared launch. Started: %d, finished: %d", launches, finishedLaunches)
+	}
+
+	rs = httptest.NewRecorder()
+	FinishLaunchesHandler(r).ServeHTTP(rs, httptest.NewRequest(http.MethodPost, "/api/v1/rp/launches/finish?event=conf", nil))
+	if http.StatusNotFound != rs.Code {
+		t.Errorf("Expected finished launch not to be found, got %d", rs.Code)
+	}
+}
+
+func TestReporterStopsBetweenEvents(t *testing.T) {
+	fake := &fakeRP{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		fake.ServeHTTP(w, rq)
+	}))
+	defer srv.Close()
+
+	store := NewMemoryQueueStore()
+	r := newTestReporter(srv.URL, store)
+	reportQuiz(r)
+	time.Sleep(30 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Stop(ctx); nil != err {
+		t.Fatalf("Cannot stop reporter: %s", err)
+	}
+
+	sent := len(fake.Calls())
+	if sent >= 10 {
+		t.Fatalf("Expected reporter to stop sending events, all %d are sent", sent)
+	}
+	queues, err := store.All()
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(queues) || 10-sent != len(queues[0].Events) {
+		t.Errorf("Expected %d unsent events to stay persisted. Got: %v", 10-sent, queues)
+	}
+}
+
+func newTestReporter(url string, store QueueStore) *Reporter {
+	r := NewReporter(NewClient(url, "test", "uuid"), store)
+	r.Attempts = 1000
+	r.Backoff = 5 * time.Millisecond
+	r.MaxBackoff = 10 * time.Millisecond
+	return r
+}
+
+//reportQuiz reports quiz of two questions. 10 events in total
+func reportQuiz(r *Reporter) {
+	ctx := context.Background()
+	launchID := r.StartLaunch(ctx, "quiz", map[string]string{"user": "tester"})
+	suiteID := r.StartSuite(ctx, launchID, "", "RP", nil)
+	for i := 0; i < 2; i++ {
+		testID := r.StartTest(ctx, launchID, suiteID, fmt.Sprintf("question %d", i), map[string]string{"category": "RP"})
+		r.Log(ctx, launchID, testID, LevelInfo, "Answer: 42")
+		r.FinishTest(ctx, launchID, testID, 0 == i)
+	}
+	r.FinishSuite(ctx, launchID, suiteID, "")
+	r.FinishLaunch(ctx, launchID, "Score: 1/2")
+}
+
+func waitUntilSent(t *testing.T, store QueueStore) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		queues, err := store.All()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 0 == len(queues) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Events haven't been sent")
+}
+
+//waitUntilDrained waits until all the events of the only queue are sent
+func waitUntilDrained(t *testing.T, store QueueStore) *Queue {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		queues, err := store.All()
+		if nil != err {
+			t.Fatal(err)
+		}
+		if 1 == len(queues) && 0 == len(queues[0].Events) {
+			return queues[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Events haven't been sent")
+	return nil
+}
+
+//verifyCalls checks items are created before they are referenced and referenced by real IDs
+func verifyCalls(t *testing.T, calls []*call) {
+	if 10 != len(calls) {
+		t.Fatalf("Expected 10 calls to RP, got %d", len(calls))
+	}
+
+	launchID := calls[0].ID
+	created := map[string]bool{}
+	for i, c := range calls {
+		var id string
+		switch {
+		case strings.HasSuffix(c.Path, "/log"):
+			//logs reference items in body
+			id, _ = c.Body["item_id"].(string)
+		case http.MethodPost == c.Method && i > 0 && launchID != c.Body["launch_id"]:
+			t.Errorf("Call %d: item isn't attached to launch %s: %v", i, launchID, c.Body)
+		case http.MethodPut == c.Method || i > 1:
+			//finishes and child items reference items in URL
+			id = referenced(c.Path)
+		}
+		if "" != id && !created[id] {
+			t.Errorf("Call %d: %s %s references item which hasn't been created", i, c.Method, c.Path)
+		}
+		if "" != c.ID {
+			created[c.ID] = true
+		}
+	}
+
+	last := calls[len(calls)-1]
+	if !strings.Contains(last.Path, launchID) {
+		t.Errorf("Launch should be finished last. Got: %s %s", last.Method, last.Path)
+	}
+}
+
+//referenced takes ID of the item referenced in URL path
+func referenced(path string) string {
+	segments := strings.Split(strings.TrimSuffix(path, "/finish"), "/")
+	return segments[len(segments)-1]
+}
@@ -0,0 +1,280 @@
+package telegram
+
+import (
+	"context"
+	"github.com/apex/log"
+	"github.com/avarabyeu/rpquiz/bot/metrics"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"gopkg.in/telegram-bot-api.v4"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+//sender sends requests to Telegram. Implemented by tgbotapi.BotAPI
+type sender interface {
+	Send(c tgbotapi.Chattable) (tgbotapi.Message, error)
+	MakeRequest(endpoint string, params url.Values) (tgbotapi.APIResponse, error)
+}
+
+//request is a request to Telegram queued by the outbox
+type request interface {
+	send(api sender) error
+}
+
+//fallible is a request which has an alternative sent if request fails
+type fallible interface {
+	fallback() request
+}
+
+//message is a request supported by tgbotapi
+type message struct {
+	tgbotapi.Chattable
+}
+
+func (m *message) send(api sender) error {
+	_, err := api.Send(m.Chattable)
+	return err
+}
+
+//Outbox sends messages to Telegram asynchronously respecting global and per-chat rate limits.
+//Messages of the same chat are sent in order they are queued. If Telegram responds with 429,
+//sending is paused for the time Telegram asks for. Telegram doesn't tell whether global or chat limit is exceeded,
+//so both the chat and all the others are paused. Transient failures are retried with exponential backoff
+type Outbox struct {
+	api     sender
+	global  *tokenBucket
+	perChat float64
+	burst   int
+
+	//Attempts is a max number of attempts to send message failed with transient error
+	Attempts int
+	//Backoff is a delay before the first retry. Doubled on each next one
+	Backoff time.Duration
+	//MaxBackoff is a max delay between retries
+	MaxBackoff time.Duration
+	//RateLimited is a max number of retries of the message Telegram responds to with 429
+	RateLimited int
+
+	mu    sync.Mutex
+	chats map[int64]*chatQueue
+	//evictEvery is how often idle chats are looked for on enqueue. Bucket of the chat is kept until it's refilled,
+	//so chats can't be always dropped once their queues are drained
+	evictEvery time.Duration
+	evictedAt  time.Time
+	closed     bool
+	wg         sync.WaitGroup
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+//chatQueue is a queue of the messages of a chat. Drained by a single goroutine to keep the order
+type chatQueue struct {
+	bucket  *tokenBucket
+	pending []*outMessage
+	running bool
+}
+
+//delay pauses sending to the chat, e.g. to pace the replies. Handled by the outbox itself
+type delay struct {
+	d time.Duration
+}
+
+func (d *delay) send(api sender) error {
+	return nil
+}
+
+//outMessage is a queued request with a logger of the update it's sent in response to
+type outMessage struct {
+	rq     request
+	logger log.Interface
+}
+
+//NewOutbox creates new instance of Outbox. Rate limits are messages per second, zero means no limit.
+//Burst is a number of messages chat may receive at once before per-chat limit applies
+func NewOutbox(api sender, globalRate, chatRate float64, burst int) *Outbox {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Outbox{
+		api:         api,
+		global:      newTokenBucket(globalRate, int(globalRate)),
+		perChat:     chatRate,
+		burst:       burst,
+		Attempts:    5,
+		Backoff:     500 * time.Millisecond,
+		MaxBackoff:  10 * time.Second,
+		RateLimited: 5,
+		chats:       map[int64]*chatQueue{},
+		evictEvery:  time.Minute,
+		evictedAt:   time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+//Send queues messages of the chat. Returns false if outbox is stopped and messages are dropped
+func (o *Outbox) Send(ctx context.Context, chatID int64, msgs ...tgbotapi.Chattable) bool {
+	rqs := make([]request, len(msgs))
+	for i, msg := range msgs {
+		rqs[i] = &message{msg}
+	}
+	return o.enqueue(ctx, chatID, rqs...)
+}
+
+//enqueue queues requests of the chat. Returns false if outbox is stopped and requests are dropped
+func (o *Outbox) enqueue(ctx context.Context, chatID int64, rqs ...request) bool {
+	logger := tracing.Logger(ctx)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		metrics.MessagesSent.WithLabelValues("telegram", "dropped").Add(float64(len(rqs)))
+		return false
+	}
+
+	o.evictIdle()
+	q, ok := o.chats[chatID]
+	if !ok {
+		q = &chatQueue{bucket: newTokenBucket(o.perChat, o.burst)}
+		o.chats[chatID] = q
+	}
+	queued := 0
+	for _, rq := range rqs {
+		q.pending = append(q.pending, &outMessage{rq: rq, logger: logger})
+		if _, ok := rq.(*delay); !ok {
+			queued++
+		}
+	}
+	metrics.MessagesQueued.WithLabelValues("telegram").Add(float64(queued))
+
+	if !q.running {
+		q.running = true
+		o.wg.Add(1)
+		go o.drain(chatID, q)
+	}
+	return true
+}
+
+//Stop stops accepting messages and waits until queued ones are sent.
+//Messages which aren't sent when context is done are dropped
+func (o *Outbox) Stop(ctx context.Context) error {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		o.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		o.cancel()
+		return nil
+	case <-ctx.Done():
+		o.cancel()
+		return ctx.Err()
+	}
+}
+
+//evictIdle drops chats which have nothing to send and whose buckets are refilled. Called under the lock
+func (o *Outbox) evictIdle() {
+	now := time.Now()
+	if now.Sub(o.evictedAt) < o.evictEvery {
+		return
+	}
+	o.evictedAt = now
+	for chatID, q := range o.chats {
+		if !q.running && 0 == len(q.pending) && q.bucket.full() {
+			delete(o.chats, chatID)
+		}
+	}
+}
+
+//drain sends messages of the chat one by one until queue is empty
+func (o *Outbox) drain(chatID int64, q *chatQueue) {
+	defer o.wg.Done()
+	for {
+		o.mu.Lock()
+		if 0 == len(q.pending) {
+			q.running = false
+			//keep the bucket until it's refilled, otherwise the chat would get a new burst
+			if q.bucket.full() {
+				delete(o.chats, chatID)
+			}
+			o.mu.Unlock()
+			return
+		}
+		m := q.pending[0]
+		q.pending = q.pending[1:]
+		o.mu.Unlock()
+
+		if d, ok := m.rq.(*delay); ok {
+			//next messages of the chat wait, other chats aren't affected
+			sleep(o.ctx, d.d)
+			continue
+		}
+		metrics.MessagesQueued.WithLabelValues("telegram").Dec()
+		err := o.deliver(q.bucket, m.rq)
+		if f, ok := m.rq.(fallible); ok && nil != err && nil == o.ctx.Err() {
+			m.logger.WithError(err).Warn("Cannot send response, sending fallback")
+			err = o.deliver(q.bucket, f.fallback())
+		}
+		if nil != err {
+			metrics.MessagesSent.WithLabelValues("telegram", "failed").Inc()
+			m.logger.WithError(err).Error("Cannot send response")
+			continue
+		}
+		metrics.MessagesSent.WithLabelValues("telegram", "sent").Inc()
+	}
+}
+
+//deliver sends message once both global and chat limits allow it. Retries transient failures
+func (o *Outbox) deliver(chat *tokenBucket, rq request) error {
+	backoff := o.Backoff
+	rateLimited := 0
+	for attempt := 1; ; {
+		if err := sleep(o.ctx, chat.reserve()); nil != err {
+			return err
+		}
+		if err := sleep(o.ctx, o.global.reserve()); nil != err {
+			return err
+		}
+
+		err := rq.send(o.api)
+		if nil == err {
+			return nil
+		}
+
+		tErr, ok := err.(tgbotapi.Error)
+		switch {
+		case ok && tErr.RetryAfter > 0:
+			//Telegram tells exactly when to retry, so it doesn't count as a failed attempt
+			if rateLimited++; rateLimited > o.RateLimited {
+				return err
+			}
+			metrics.MessagesRetried.WithLabelValues("telegram", "rate_limited").Inc()
+			retryAfter := time.Duration(tErr.RetryAfter) * time.Second
+			chat.pause(retryAfter)
+			o.global.pause(retryAfter)
+		case ok:
+			//request is rejected, e.g. message is malformed. Retry won't help
+			return err
+		case os.IsNotExist(err):
+			//uploaded file is missing
+			return err
+		case attempt >= o.Attempts:
+			return err
+		default:
+			metrics.MessagesRetried.WithLabelValues("telegram", "error").Inc()
+			if err := sleep(o.ctx, backoff); nil != err {
+				return err
+			}
+			attempt++
+			if backoff *= 2; backoff > o.MaxBackoff {
+				backoff = o.MaxBackoff
+			}
+		}
+	}
+}
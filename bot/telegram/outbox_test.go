@@ -0,0 +1,276 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/telegram-bot-api.v4"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//sent is a message received by fake Bot API
+type sent struct {
+	ChatID int64
+	Text   string
+	At     time.Time
+	Method string
+	Form   url.Values
+}
+
+//fakeBotAPI is a fake Telegram Bot API server. Responds with queued failures first
+type fakeBotAPI struct {
+	mu   sync.Mutex
+	sent []*sent
+	//failures are responses of the next send calls: HTTP status and retry_after
+	failures []failure
+	//updates are returned by getUpdates
+	updates json.RawMessage
+}
+
+type failure struct {
+	status     int
+	retryAfter int
+}
+
+func (f *fakeBotAPI) ServeHTTP(w http.ResponseWriter, rq *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if "/botTOKEN/getMe" == rq.URL.Path {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": map[string]interface{}{"id": 1, "username": "rpquiz"}})
+		return
+	}
+
+	if "/botTOKEN/getUpdates" == rq.URL.Path {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": f.updates})
+		return
+	}
+
+	rq.ParseForm()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.failures) > 0 {
+		fail := f.failures[0]
+		f.failures = f.failures[1:]
+		w.WriteHeader(fail.status)
+		if http.StatusTooManyRequests != fail.status {
+			w.Write([]byte("Bad Gateway"))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":          false,
+			"error_code":  fail.status,
+			"description": fmt.Sprintf("Too Many Requests: retry after %d", fail.retryAfter),
+			"parameters":  map[string]int{"retry_after": fail.retryAfter},
+		})
+		return
+	}
+
+	chatID, _ := strconv.ParseInt(rq.PostForm.Get("chat_id"), 10, 64)
+	method := rq.URL.Path[strings.LastIndex(rq.URL.Path, "/")+1:]
+	f.sent = append(f.sent, &sent{ChatID: chatID, Text: rq.PostForm.Get("text"), At: time.Now(), Method: method, Form: rq.PostForm})
+	result := map[string]interface{}{"message_id": len(f.sent)}
+	if "sendPoll" == method {
+		result["poll"] = map[string]string{"id": fmt.Sprintf("poll-%d", len(f.sent))}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": result})
+}
+
+func (f *fakeBotAPI) Sent() []*sent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*sent{}, f.sent...)
+}
+
+//redirect sends requests to Bot API to the fake server
+type redirect struct {
+	target *url.URL
+}
+
+func (r *redirect) RoundTrip(rq *http.Request) (*http.Response, error) {
+	rq.URL.Scheme = r.target.Scheme
+	rq.URL.Host = r.target.Host
+	return http.DefaultTransport.RoundTrip(rq)
+}
+
+func TestOutboxOrderAndRetries(t *testing.T) {
+	fake := &fakeBotAPI{failures: []failure{
+		{status: http.StatusTooManyRequests, retryAfter: 1},
+		{status: http.StatusBadGateway},
+	}}
+	outbox := newTestOutbox(t, fake, 0, 0)
+
+	var wg sync.WaitGroup
+	for chat := int64(1); chat <= 5; chat++ {
+		wg.Add(1)
+		go func(chat int64) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				outbox.Send(context.Background(), chat, tgbotapi.NewMessage(chat, strconv.Itoa(i)))
+			}
+		}(chat)
+	}
+	wg.Wait()
+	stopOutbox(t, outbox)
+
+	messages := fake.Sent()
+	if 50 != len(messages) {
+		t.Fatalf("Expected 50 messages to be sent, got %d", len(messages))
+	}
+	next := map[int64]int{}
+	for _, m := range messages {
+		if strconv.Itoa(next[m.ChatID]) != m.Text {
+			t.Errorf("Chat %d: expected message %d, got %s", m.ChatID, next[m.ChatID], m.Text)
+		}
+		next[m.ChatID]++
+	}
+}
+
+func TestOutboxHonorsRetryAfter(t *testing.T) {
+	fake := &fakeBotAPI{failures: []failure{{status: http.StatusTooManyRequests, retryAfter: 1}}}
+	outbox := newTestOutbox(t, fake, 0, 0)
+
+	start := time.Now()
+	outbox.Send(context.Background(), 1, tgbotapi.NewMessage(1, "0"), tgbotapi.NewMessage(1, "1"))
+	stopOutbox(t, outbox)
+
+	messages := fake.Sent()
+	if 2 != len(messages) {
+		t.Fatalf("Expected 2 messages to be sent, got %d", len(messages))
+	}
+	if elapsed := messages[0].At.Sub(start); elapsed < time.Second {
+		t.Errorf("Expected chat to be paused for a second, message is sent in %s", elapsed)
+	}
+}
+
+func TestOutboxPausesAllChatsOnRetryAfter(t *testing.T) {
+	fake := &fakeBotAPI{failures: []failure{{status: http.StatusTooManyRequests, retryAfter: 1}}}
+	outbox := newTestOutbox(t, fake, 0, 0)
+
+	start := time.Now()
+	outbox.Send(context.Background(), 1, tgbotapi.NewMessage(1, "0"))
+	//429 may be caused by the global limit, so other chats wait too
+	time.Sleep(100 * time.Millisecond)
+	outbox.Send(context.Background(), 2, tgbotapi.NewMessage(2, "0"))
+	stopOutbox(t, outbox)
+
+	for _, m := range fake.Sent() {
+		if elapsed := m.At.Sub(start); elapsed < time.Second {
+			t.Errorf("Expected chat %d to be paused for a second, message is sent in %s", m.ChatID, elapsed)
+		}
+	}
+}
+
+func TestOutboxLimitsRateLimitedRetries(t *testing.T) {
+	fake := &fakeBotAPI{failures: []failure{
+		{status: http.StatusTooManyRequests, retryAfter: 1},
+		{status: http.StatusTooManyRequests, retryAfter: 1},
+	}}
+	outbox := newTestOutbox(t, fake, 0, 0)
+	outbox.RateLimited = 1
+
+	outbox.Send(context.Background(), 1, tgbotapi.NewMessage(1, "0"), tgbotapi.NewMessage(1, "1"))
+	stopOutbox(t, outbox)
+
+	messages := fake.Sent()
+	if 1 != len(messages) || "1" != messages[0].Text {
+		t.Errorf("Expected message to be dropped after retry, next one to be sent, got %v", messages)
+	}
+}
+
+func TestOutboxEvictsIdleChats(t *testing.T) {
+	fake := &fakeBotAPI{}
+	//chat gets 2 messages at once, bucket is refilled in 100ms
+	outbox := newTestOutbox(t, fake, 0, 20)
+	outbox.evictEvery = 0
+
+	for chat := int64(1); chat <= 10; chat++ {
+		for i := 0; i < 3; i++ {
+			outbox.Send(context.Background(), chat, tgbotapi.NewMessage(chat, strconv.Itoa(i)))
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); 30 != len(fake.Sent()) && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	outbox.Send(context.Background(), 11, tgbotapi.NewMessage(11, "0"))
+	outbox.mu.Lock()
+	chats := len(outbox.chats)
+	outbox.mu.Unlock()
+	if chats > 1 {
+		t.Errorf("Expected idle chats to be evicted, %d chats are kept", chats)
+	}
+	stopOutbox(t, outbox)
+}
+
+func TestOutboxRateLimits(t *testing.T) {
+	fake := &fakeBotAPI{}
+	//chat gets 2 messages at once, then 1 message per 50ms
+	outbox := newTestOutbox(t, fake, 0, 20)
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		outbox.Send(context.Background(), 1, tgbotapi.NewMessage(1, strconv.Itoa(i)))
+	}
+	//other chats aren't affected
+	outbox.Send(context.Background(), 2, tgbotapi.NewMessage(2, "0"))
+	stopOutbox(t, outbox)
+
+	for _, m := range fake.Sent() {
+		if 2 == m.ChatID && m.At.Sub(start) > 100*time.Millisecond {
+			t.Errorf("Chat 2 is throttled by chat 1: message is sent in %s", m.At.Sub(start))
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected chat limit to be applied, 6 messages are sent in %s", elapsed)
+	}
+
+	//global limit applies to all chats
+	fake = &fakeBotAPI{}
+	outbox = newTestOutbox(t, fake, 20, 0)
+	start = time.Now()
+	for chat := int64(1); chat <= 25; chat++ {
+		outbox.Send(context.Background(), chat, tgbotapi.NewMessage(chat, "0"))
+	}
+	stopOutbox(t, outbox)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Expected global limit to be applied, 25 messages are sent in %s", elapsed)
+	}
+}
+
+func TestOutboxDropsAfterStop(t *testing.T) {
+	fake := &fakeBotAPI{}
+	outbox := newTestOutbox(t, fake, 0, 0)
+	stopOutbox(t, outbox)
+
+	if outbox.Send(context.Background(), 1, tgbotapi.NewMessage(1, "0")) {
+		t.Error("Expected message to be dropped")
+	}
+}
+
+func newTestOutbox(t *testing.T, fake *fakeBotAPI, globalRate, chatRate float64) *Outbox {
+	srv := httptest.NewServer(fake)
+	target, _ := url.Parse(srv.URL)
+	api, err := tgbotapi.NewBotAPIWithClient("TOKEN", &http.Client{Transport: &redirect{target: target}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	outbox := NewOutbox(api, globalRate, chatRate, 2)
+	outbox.Backoff = 10 * time.Millisecond
+	return outbox
+}
+
+func stopOutbox(t *testing.T, outbox *Outbox) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := outbox.Stop(ctx); nil != err {
+		t.Fatalf("Messages aren't sent in time: %s", err)
+	}
+}
@@ -0,0 +1,258 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"gopkg.in/telegram-bot-api.v4"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+//Telegram limits of the quiz polls
+const (
+	pollMinOptions     = 2
+	pollMaxOptions     = 10
+	pollQuestionLimit  = 300
+	pollOptionLimit    = 100
+	pollExplanationMax = 200
+	pollMinOpenPeriod  = 5 * time.Second
+	pollMaxOpenPeriod  = 600 * time.Second
+)
+
+const (
+	//pollSaveWait is max time answer to the unknown poll waits for the poll being sent to the user to be saved
+	pollSaveWait = 5 * time.Second
+	//pollCloseGrace is a delay after poll is closed before question is sent again with buttons,
+	//so answers made at the last moment are handled first
+	pollCloseGrace = 2 * time.Second
+	//pollClosedText is sent when time to answer the poll is over while question isn't answered
+	pollClosedText = "Time to answer the poll is over, but you still can choose the answer:"
+)
+
+//pollRequest sends question as a quiz poll. tgbotapi doesn't support polls, so request is made directly
+type pollRequest struct {
+	chatID      int64
+	question    string
+	options     []string
+	correct     int
+	explanation string
+	openPeriod  time.Duration
+	//text is the question with buttons sent if poll can't be sent
+	text tgbotapi.Chattable
+	//onSent is called with ID of the sent poll
+	onSent func(pollID string)
+	//onFailed is called if poll can't be sent
+	onFailed func()
+}
+
+//fallback sends question with buttons instead of the poll
+func (p *pollRequest) fallback() request {
+	if nil != p.onFailed {
+		p.onFailed()
+	}
+	return &message{p.text}
+}
+
+func (p *pollRequest) send(api sender) error {
+	options, err := json.Marshal(p.options)
+	if nil != err {
+		return err
+	}
+	params := url.Values{}
+	params.Set("chat_id", strconv.FormatInt(p.chatID, 10))
+	params.Set("question", p.question)
+	params.Set("options", string(options))
+	params.Set("type", "quiz")
+	//answers of anonymous polls aren't sent to the bot
+	params.Set("is_anonymous", "false")
+	params.Set("correct_option_id", strconv.Itoa(p.correct))
+	if "" != p.explanation {
+		params.Set("explanation", p.explanation)
+	}
+	if p.openPeriod > 0 {
+		params.Set("open_period", strconv.Itoa(int(p.openPeriod/time.Second)))
+	}
+
+	rs, err := api.MakeRequest("sendPoll", params)
+	if nil != err {
+		return err
+	}
+
+	//poll is sent already, so decoding error must not cause a retry
+	var msg struct {
+		Poll struct {
+			ID string `json:"id"`
+		} `json:"poll"`
+	}
+	json.Unmarshal(rs.Result, &msg)
+	if nil != p.onSent {
+		p.onSent(msg.Poll.ID)
+	}
+	return nil
+}
+
+//pollOf converts response to a quiz poll if response is a question which fits Telegram limits
+func pollOf(chatID int64, rs *bot.Response, openPeriod time.Duration) (*pollRequest, bool) {
+	if nil == rs.Poll || len(rs.Buttons) < pollMinOptions || len(rs.Buttons) > pollMaxOptions ||
+		rs.Poll.Correct < 0 || rs.Poll.Correct >= len(rs.Buttons) {
+		return nil, false
+	}
+	question := rs.Text.String()
+	if 0 == len(question) || utf8.RuneCountInString(question) > pollQuestionLimit {
+		return nil, false
+	}
+
+	options := make([]string, len(rs.Buttons))
+	for i, btn := range rs.Buttons {
+		if "" == btn.Data || "" != btn.URL || 0 == len(btn.Text) || utf8.RuneCountInString(btn.Text) > pollOptionLimit {
+			return nil, false
+		}
+		options[i] = btn.Text
+	}
+
+	explanation := rs.Poll.Explanation
+	if utf8.RuneCountInString(explanation) > pollExplanationMax {
+		explanation = ""
+	}
+	if openPeriod > 0 && openPeriod < pollMinOpenPeriod {
+		openPeriod = pollMinOpenPeriod
+	}
+	if openPeriod > pollMaxOpenPeriod {
+		openPeriod = pollMaxOpenPeriod
+	}
+	return &pollRequest{
+		chatID:      chatID,
+		question:    question,
+		options:     options,
+		correct:     rs.Poll.Correct,
+		explanation: explanation,
+		openPeriod:  openPeriod,
+		text:        textOf(chatID, rs),
+	}, true
+}
+
+//pollSent keeps callback data of the poll options in the session of the user once poll is sent,
+//so poll answer can be mapped back. Poll is sent asynchronously, so answers wait until it's saved
+func (b *Bot) pollSent(ctx context.Context, userID string, poll *pollRequest, rs *bot.Response) {
+	data := make([]string, len(rs.Buttons))
+	for i, btn := range rs.Buttons {
+		data[i] = btn.Data
+	}
+	//question is asked already, while user may answer it by text before the poll is sent
+	question := -1
+	var session db.QuizSession
+	if err := b.Sessions.Load(ctx, userID, &session); nil == err {
+		question = len(session.Results)
+	}
+	saved := b.pollSending(userID)
+	poll.onFailed = saved
+	poll.onSent = func(pollID string) {
+		defer saved()
+		if "" == pollID {
+			tracing.Logger(ctx).Error("Poll is sent but its ID is unknown. Answers to the poll will be ignored")
+			return
+		}
+		if err := b.Sessions.Patch(ctx, userID, db.SetPoll(&db.Poll{ID: pollID, ChatID: poll.chatID, Options: data, Question: question})); nil != err {
+			tracing.Logger(ctx).WithError(err).Error("Cannot save poll. Answers to the poll will be ignored")
+			return
+		}
+		if poll.openPeriod > 0 {
+			time.AfterFunc(poll.openPeriod+pollCloseGrace, func() {
+				b.pollClosed(ctx, userID, pollID, poll.text)
+			})
+		}
+	}
+}
+
+//pollSending marks poll of the user as being sent. Returned func is called once poll is saved or it can't be sent
+func (b *Bot) pollSending(userID string) func() {
+	sending := make(chan struct{})
+	b.pollsMu.Lock()
+	if nil == b.polls {
+		b.polls = map[string]chan struct{}{}
+	}
+	b.polls[userID] = sending
+	b.pollsMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.pollsMu.Lock()
+			if sending == b.polls[userID] {
+				delete(b.polls, userID)
+			}
+			b.pollsMu.Unlock()
+			close(sending)
+		})
+	}
+}
+
+//waitPoll waits until poll being sent to the user is saved. Returns false if there is no such poll or it isn't saved in time
+func (b *Bot) waitPoll(ctx context.Context, userID string) bool {
+	b.pollsMu.Lock()
+	sending, ok := b.polls[userID]
+	b.pollsMu.Unlock()
+	if !ok {
+		return false
+	}
+	timer := time.NewTimer(pollSaveWait)
+	defer timer.Stop()
+	select {
+	case <-sending:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+//pollClosed sends question with buttons once time to answer the poll is over, unless it's answered already
+//either by the poll, buttons or text
+func (b *Bot) pollClosed(ctx context.Context, userID string, pollID string, text tgbotapi.Chattable) {
+	//checked by the worker of the user, so it doesn't race with the answers
+	b.pool.Submit(userID, func() {
+		var session db.QuizSession
+		if err := b.Sessions.Load(ctx, userID, &session); nil != err || nil == session.Poll || pollID != session.Poll.ID ||
+			len(session.Results) != session.Poll.Question {
+			return
+		}
+		tracing.Logger(ctx).Debug("Poll is closed, question is sent with buttons")
+		closed := textOf(session.Poll.ChatID, bot.NewResponse().WithText(pollClosedText))
+		b.outbox.enqueue(ctx, session.Poll.ChatID, &message{closed}, &message{text})
+	})
+}
+
+//answerOf maps answer to the poll back to the callback data of the chosen option and chat poll is sent to
+func (b *Bot) answerOf(ctx context.Context, userID string, answer *pollAnswer) (string, int64, bool) {
+	if 1 != len(answer.OptionIDs) {
+		//vote is retracted
+		return "", 0, false
+	}
+	for {
+		var session db.QuizSession
+		if err := b.Sessions.Load(ctx, userID, &session); nil != err {
+			if db.ErrNotFound != err {
+				tracing.Logger(ctx).WithError(err).Error("Cannot load session of the poll")
+			}
+			return "", 0, false
+		}
+		poll, option := session.Poll, answer.OptionIDs[0]
+		if nil != poll && answer.PollID == poll.ID {
+			if option < 0 || option >= len(poll.Options) {
+				return "", 0, false
+			}
+			return poll.Options[option], poll.ChatID, true
+		}
+		//answer may come before the poll is saved
+		if !b.waitPoll(ctx, userID) {
+			return "", 0, false
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/avarabyeu/rpquiz/bot/db"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollOf(t *testing.T) {
+	question := func() *bot.Response {
+		return bot.NewResponse().WithText("What is ReportPortal?").
+			WithButtons(&bot.Button{Text: "TMS", Data: "a"}, &bot.Button{Text: "Test reporting", Data: "b"}).
+			WithPoll(1, "It collects test results")
+	}
+
+	poll, ok := pollOf(1, question(), time.Second)
+	if !ok {
+		t.Fatal("Expected question to be sent as poll")
+	}
+	if "What is ReportPortal?" != poll.question || 2 != len(poll.options) || 1 != poll.correct ||
+		"It collects test results" != poll.explanation || pollMinOpenPeriod != poll.openPeriod {
+		t.Errorf("Unexpected poll: %+v", poll)
+	}
+
+	for name, rs := range map[string]*bot.Response{
+		"not a question":   bot.NewResponse().WithText("Hi").WithButtons(&bot.Button{Text: "TMS", Data: "a"}, &bot.Button{Text: "RP", Data: "b"}),
+		"single option":    question().WithButtons(&bot.Button{Text: "TMS", Data: "a"}),
+		"URL button":       question().WithButtons(&bot.Button{Text: "TMS", Data: "a"}, bot.NewURLButton("RP", "https://rp.io")),
+		"long question":    question().WithText(strings.Repeat("?", pollQuestionLimit+1)),
+		"wrong correct ID": question().WithPoll(2, ""),
+	} {
+		if _, ok := pollOf(1, rs, 0); ok {
+			t.Errorf("%s: expected response not to be sent as poll", name)
+		}
+	}
+}
+
+func TestPollAnswer(t *testing.T) {
+	fake := &fakeBotAPI{}
+	outbox := newTestOutbox(t, fake, 0, 0)
+	repo := db.NewMemorySessionRepo()
+	ctx := context.Background()
+	if err := repo.Save(ctx, &db.QuizSession{ID: "42"}); nil != err {
+		t.Fatal(err)
+	}
+	b := &Bot{Sessions: repo, QuizPolls: true, outbox: outbox}
+
+	rs := bot.NewResponse().WithText("What is ReportPortal?").
+		WithButtons(&bot.Button{Text: "TMS", Data: "a.sig"}, &bot.Button{Text: "Test reporting", Data: "b.sig"}).
+		WithPoll(1, "")
+	poll, _ := pollOf(42, rs, 0)
+	b.pollSent(ctx, "42", poll, rs)
+	outbox.enqueue(ctx, 42, poll)
+	stopOutbox(t, outbox)
+
+	calls := fake.Sent()
+	if 1 != len(calls) || "sendPoll" != calls[0].Method {
+		t.Fatalf("Expected poll to be sent, got %+v", calls)
+	}
+	form := calls[0].Form
+	if "quiz" != form.Get("type") || "false" != form.Get("is_anonymous") || "1" != form.Get("correct_option_id") ||
+		`["TMS","Test reporting"]` != form.Get("options") {
+		t.Errorf("Unexpected poll parameters: %v", form)
+	}
+
+	for _, c := range []struct {
+		name   string
+		answer *pollAnswer
+		data   string
+		ok     bool
+	}{
+		{"answer", &pollAnswer{PollID: "poll-1", OptionIDs: []int{1}}, "b.sig", true},
+		{"other poll", &pollAnswer{PollID: "poll-2", OptionIDs: []int{1}}, "", false},
+		{"retracted vote", &pollAnswer{PollID: "poll-1"}, "", false},
+		{"unknown option", &pollAnswer{PollID: "poll-1", OptionIDs: []int{5}}, "", false},
+	} {
+		data, chatID, ok := b.answerOf(ctx, "42", c.answer)
+		if c.ok != ok || c.data != data || (ok && 42 != chatID) {
+			t.Errorf("%s: expected %s %v, got %s %v in chat %d", c.name, c.data, c.ok, data, ok, chatID)
+		}
+	}
+	if _, _, ok := b.answerOf(ctx, "43", &pollAnswer{PollID: "poll-1", OptionIDs: []int{1}}); ok {
+		t.Error("Expected answer of the user without session to be ignored")
+	}
+}
+
+func TestPollAnswerBeforePollIsSaved(t *testing.T) {
+	repo := db.NewMemorySessionRepo()
+	ctx := context.Background()
+	repo.Save(ctx, &db.QuizSession{ID: "42"})
+	b := &Bot{Sessions: repo, QuizPolls: true}
+
+	rs := question()
+	poll, _ := pollOf(42, rs, 0)
+	b.pollSent(ctx, "42", poll, rs)
+	//answer is handled by the worker while outbox saves the poll
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		poll.onSent("poll-1")
+	}()
+
+	data, _, ok := b.answerOf(ctx, "42", &pollAnswer{PollID: "poll-1", OptionIDs: []int{1}})
+	if !ok || "b.sig" != data {
+		t.Errorf("Expected answer to wait until poll is saved, got %s %v", data, ok)
+	}
+	if _, _, ok := b.answerOf(ctx, "42", &pollAnswer{PollID: "poll-2", OptionIDs: []int{1}}); ok {
+		t.Error("Expected answer of unknown poll to be ignored once poll is saved")
+	}
+}
+
+func TestPollFallsBackToButtons(t *testing.T) {
+	fake := &fakeBotAPI{failures: []failure{{status: http.StatusBadGateway}}}
+	outbox := newTestOutbox(t, fake, 0, 0)
+	outbox.Attempts = 1
+	repo := db.NewMemorySessionRepo()
+	ctx := context.Background()
+	repo.Save(ctx, &db.QuizSession{ID: "42"})
+	b := &Bot{Sessions: repo, QuizPolls: true, outbox: outbox}
+
+	rs := question()
+	poll, _ := pollOf(42, rs, 0)
+	b.pollSent(ctx, "42", poll, rs)
+	outbox.enqueue(ctx, 42, poll)
+	stopOutbox(t, outbox)
+
+	calls := fake.Sent()
+	if 1 != len(calls) || "sendMessage" != calls[0].Method || "What is ReportPortal?" != calls[0].Text {
+		t.Fatalf("Expected question to be sent with buttons, got %+v", calls)
+	}
+	if _, _, ok := b.answerOf(ctx, "42", &pollAnswer{PollID: "poll-1", OptionIDs: []int{1}}); ok {
+		t.Error("Expected answer of the poll which isn't sent to be ignored")
+	}
+}
+
+func TestPollClosed(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		//answer is a change of the session made once poll is sent
+		answer []db.PatchOp
+		exp    []string
+	}{
+		{"unanswered", nil, []string{"sendPoll", "sendMessage", "sendMessage"}},
+		{"next question is a poll", []db.PatchOp{db.SetResult(0, true), db.SetPoll(&db.Poll{ID: "poll-2", Question: 1})}, []string{"sendPoll"}},
+		//e.g. answer is typed, next question is sent with buttons
+		{"next question isn't a poll", []db.PatchOp{db.SetResult(0, true)}, []string{"sendPoll"}},
+	} {
+		fake := &fakeBotAPI{}
+		outbox := newTestOutbox(t, fake, 0, 0)
+		repo := db.NewMemorySessionRepo()
+		ctx := context.Background()
+		repo.Save(ctx, &db.QuizSession{ID: "42"})
+		b := &Bot{Sessions: repo, QuizPolls: true, outbox: outbox, pool: bot.NewWorkerPool(1, 1)}
+
+		rs := question()
+		poll, _ := pollOf(42, rs, time.Second)
+		poll.openPeriod = 10 * time.Millisecond
+		b.pollSent(ctx, "42", poll, rs)
+		outbox.enqueue(ctx, 42, poll)
+		if nil != c.answer {
+			b.waitPoll(ctx, "42")
+			repo.Patch(ctx, "42", c.answer...)
+		}
+
+		time.Sleep(pollCloseGrace + 200*time.Millisecond)
+		b.pool.Stop(ctx)
+		stopOutbox(t, outbox)
+
+		var methods []string
+		for _, call := range fake.Sent() {
+			methods = append(methods, call.Method)
+		}
+		if !reflect.DeepEqual(c.exp, methods) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.exp, methods)
+		}
+		if sent := fake.Sent(); 3 == len(sent) && ("What is ReportPortal?" != sent[2].Text || "" == sent[2].Form.Get("reply_markup")) {
+			t.Errorf("%s: expected question to be sent with buttons, got %+v", c.name, sent[2])
+		}
+	}
+}
+
+func TestGetUpdates(t *testing.T) {
+	fake := &fakeBotAPI{updates: json.RawMessage(`[
+		{"update_id": 1, "message": {"message_id": 1, "text": "/start", "from": {"id": 42}, "chat": {"id": 42}}},
+		{"update_id": 2, "poll_answer": {"poll_id": "poll-1", "user": {"id": 42}, "option_ids": [1]}}
+	]`)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	target, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &redirect{target: target}}
+
+	updates, err := getUpdates(context.Background(), client, "TOKEN", 1)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if 2 != len(updates) {
+		t.Fatalf("Expected 2 updates, got %d", len(updates))
+	}
+	if nil == updates[0].Message || "/start" != updates[0].Message.Text {
+		t.Errorf("Expected message, got %+v", updates[0])
+	}
+	if a := updates[1].PollAnswer; nil == a || "poll-1" != a.PollID || 42 != a.User.ID || 1 != a.OptionIDs[0] {
+		t.Errorf("Expected poll answer, got %+v", updates[1])
+	}
+}
+
+//question is a single-answer question which may be sent as a poll
+func question() *bot.Response {
+	return bot.NewResponse().WithText("What is ReportPortal?").
+		WithButtons(&bot.Button{Text: "TMS", Data: "a.sig"}, &bot.Button{Text: "Test reporting", Data: "b.sig"}).
+		WithPoll(1, "")
+}
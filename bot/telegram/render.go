@@ -0,0 +1,156 @@
+package telegram
+
+import (
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"gopkg.in/telegram-bot-api.v4"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	parseMode = "MarkdownV2"
+	//typingPeriod is how often typing indicator is refreshed. Telegram shows it for 5 seconds
+	typingPeriod = 4 * time.Second
+	//captionLimit is a max length of the caption of the photo or document
+	captionLimit = 1024
+)
+
+//messagesOf converts response to Telegram messages. Attachments are sent first.
+//Text becomes a caption of the last attachment if it fits, otherwise it's sent as a separate message
+func messagesOf(chatID int64, rs *bot.Response) []tgbotapi.Chattable {
+	text := rs.Text.MarkdownV2()
+	markup := keyboardOf(rs)
+
+	msgs := make([]tgbotapi.Chattable, 0, len(rs.Attachments)+1)
+	for i, a := range rs.Attachments {
+		if i == len(rs.Attachments)-1 && utf8.RuneCountInString(text) <= captionLimit {
+			msgs = append(msgs, attachmentOf(chatID, a, text, markup))
+			return msgs
+		}
+		msgs = append(msgs, attachmentOf(chatID, a, "", nil))
+	}
+
+	return append(msgs, textOf(chatID, rs))
+}
+
+//textOf converts text and buttons of the response to Telegram message
+func textOf(chatID int64, rs *bot.Response) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatID, rs.Text.MarkdownV2())
+	msg.ParseMode = parseMode
+	msg.ReplyMarkup = keyboardOf(rs)
+	return msg
+}
+
+//requestsOf converts response to the requests queued by the outbox. If attachment the text is a caption of
+//can't be sent, text is sent as a separate message, so the question isn't lost along with the attachment
+func requestsOf(chatID int64, rs *bot.Response) []request {
+	msgs := messagesOf(chatID, rs)
+	rqs := make([]request, len(msgs))
+	for i, msg := range msgs {
+		rqs[i] = &message{msg}
+	}
+	if last := len(msgs) - 1; 0 != len(rs.Attachments) && len(msgs) == len(rs.Attachments) {
+		rqs[last] = &captioned{message: message{msgs[last]}, text: textOf(chatID, rs)}
+	}
+	return rqs
+}
+
+//captioned is an attachment with the text of the response as a caption
+type captioned struct {
+	message
+	text tgbotapi.Chattable
+}
+
+//fallback sends the text without attachment
+func (c *captioned) fallback() request {
+	return &message{c.text}
+}
+
+//pacingOf creates requests preceding the response: delay and typing indicator refreshed during the delay
+func pacingOf(chatID int64, rs *bot.Response) []request {
+	if rs.Delay <= 0 {
+		return nil
+	}
+	if !rs.Typing {
+		return []request{&delay{rs.Delay}}
+	}
+	var rqs []request
+	for left := rs.Delay; left > 0; left -= typingPeriod {
+		d := left
+		if d > typingPeriod {
+			d = typingPeriod
+		}
+		rqs = append(rqs, &message{tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)}, &delay{d})
+	}
+	return rqs
+}
+
+//attachmentOf converts attachment to photo or document message
+func attachmentOf(chatID int64, a *bot.Attachment, caption string, markup interface{}) tgbotapi.Chattable {
+	if bot.AttachmentImage == a.Kind {
+		var photo tgbotapi.PhotoConfig
+		if "" != a.URL {
+			photo = tgbotapi.NewPhotoShare(chatID, a.URL)
+		} else {
+			photo = tgbotapi.NewPhotoUpload(chatID, fileOf(a))
+		}
+		photo.Caption = caption
+		photo.ParseMode = parseMode
+		photo.ReplyMarkup = markup
+		return photo
+	}
+
+	var doc tgbotapi.DocumentConfig
+	if "" != a.URL {
+		doc = tgbotapi.NewDocumentShare(chatID, a.URL)
+	} else {
+		doc = tgbotapi.NewDocumentUpload(chatID, fileOf(a))
+	}
+	doc.Caption = caption
+	doc.ParseMode = parseMode
+	doc.ReplyMarkup = markup
+	return doc
+}
+
+//fileOf returns file to be uploaded: embedded content or path to the local file
+func fileOf(a *bot.Attachment) interface{} {
+	if nil != a.Data {
+		return tgbotapi.FileBytes{Name: a.Name, Bytes: a.Data}
+	}
+	return a.Path
+}
+
+//keyboardOf converts buttons to inline or reply keyboard. Returns nil if there is nothing to show
+func keyboardOf(rs *bot.Response) interface{} {
+	if 0 == len(rs.Buttons) {
+		if rs.RemoveKeyboard {
+			return tgbotapi.NewRemoveKeyboard(false)
+		}
+		return nil
+	}
+
+	rows := rs.Rows()
+	if bot.KeyboardReply == rs.Keyboard {
+		keyboard := make([][]tgbotapi.KeyboardButton, len(rows))
+		for i, row := range rows {
+			for _, btn := range row {
+				keyboard[i] = append(keyboard[i], tgbotapi.NewKeyboardButton(btn.Text))
+			}
+		}
+		markup := tgbotapi.NewReplyKeyboard(keyboard...)
+		markup.OneTimeKeyboard = true
+		return markup
+	}
+
+	keyboard := make([][]tgbotapi.InlineKeyboardButton, len(rows))
+	for i, row := range rows {
+		for _, btn := range row {
+			if "" != btn.URL {
+				keyboard[i] = append(keyboard[i], tgbotapi.NewInlineKeyboardButtonURL(btn.Text, btn.URL))
+				continue
+			}
+			keyboard[i] = append(keyboard[i], tgbotapi.NewInlineKeyboardButtonData(btn.Text, btn.Data))
+		}
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(keyboard...)
+}
@@ -0,0 +1,147 @@
+package telegram
+
+import (
+	"context"
+	"github.com/avarabyeu/rpquiz/bot/engine"
+	"gopkg.in/telegram-bot-api.v4"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessagesOf(t *testing.T) {
+	image := &bot.Attachment{Kind: bot.AttachmentImage, Name: "widget.png", Path: "/assets/widget.png"}
+	doc := &bot.Attachment{Kind: bot.AttachmentDocument, Name: "report.xml", Data: []byte("<xml/>")}
+	btn := &bot.Button{Text: "Launches table", Data: "token.sig"}
+
+	//text only
+	msgs := messagesOf(1, bot.NewResponse().WithText("What is it?").WithButtons(btn))
+	if 1 != len(msgs) {
+		t.Fatalf("Expected single message, got %d", len(msgs))
+	}
+	if msg, ok := msgs[0].(tgbotapi.MessageConfig); !ok || "What is it?" != msg.Text || nil == msg.ReplyMarkup {
+		t.Errorf("Expected text message with buttons, got %+v", msgs[0])
+	}
+
+	//text is a caption of the last attachment
+	msgs = messagesOf(1, bot.NewResponse().WithText("What is it?").WithButtons(btn).WithAttachments(doc, image))
+	if 2 != len(msgs) {
+		t.Fatalf("Expected 2 messages, got %d", len(msgs))
+	}
+	if d, ok := msgs[0].(tgbotapi.DocumentConfig); !ok || "" != d.Caption || nil != d.ReplyMarkup {
+		t.Errorf("Expected document without caption, got %+v", msgs[0])
+	} else if f, ok := d.File.(tgbotapi.FileBytes); !ok || "report.xml" != f.Name {
+		t.Errorf("Expected embedded document to be uploaded, got %+v", d.File)
+	}
+	if p, ok := msgs[1].(tgbotapi.PhotoConfig); !ok || "What is it?" != p.Caption || nil == p.ReplyMarkup {
+		t.Errorf("Expected photo with caption and buttons, got %+v", msgs[1])
+	} else if "/assets/widget.png" != p.File {
+		t.Errorf("Expected local image to be uploaded, got %+v", p.File)
+	}
+
+	//long text doesn't fit into caption
+	long := strings.Repeat("a", captionLimit+1)
+	msgs = messagesOf(1, bot.NewResponse().WithText(long).WithAttachments(&bot.Attachment{Kind: bot.AttachmentImage, URL: "https://rp.io/w.png"}))
+	if 2 != len(msgs) {
+		t.Fatalf("Expected 2 messages, got %d", len(msgs))
+	}
+	if p, ok := msgs[0].(tgbotapi.PhotoConfig); !ok || "" != p.Caption || "https://rp.io/w.png" != p.FileID {
+		t.Errorf("Expected shared photo without caption, got %+v", msgs[0])
+	}
+	if msg, ok := msgs[1].(tgbotapi.MessageConfig); !ok || long != msg.Text {
+		t.Errorf("Expected text message, got %+v", msgs[1])
+	}
+}
+
+func TestKeyboardOf(t *testing.T) {
+	btns := []*bot.Button{{Text: "1", Data: "a"}, {Text: "2", Data: "b"}, bot.NewURLButton("RP", "https://rp.io")}
+
+	inline, ok := keyboardOf(bot.NewResponse().WithButtons(btns...).WithColumns(2)).(tgbotapi.InlineKeyboardMarkup)
+	if !ok || 2 != len(inline.InlineKeyboard) || 2 != len(inline.InlineKeyboard[0]) {
+		t.Fatalf("Expected inline keyboard of 2 rows, got %+v", inline)
+	}
+	if url := inline.InlineKeyboard[1][0].URL; nil == url || "https://rp.io" != *url {
+		t.Errorf("Expected URL button, got %+v", inline.InlineKeyboard[1][0])
+	}
+	if data := inline.InlineKeyboard[0][1].CallbackData; nil == data || "b" != *data {
+		t.Errorf("Expected callback button, got %+v", inline.InlineKeyboard[0][1])
+	}
+
+	reply, ok := keyboardOf(bot.NewResponse().WithButtons(btns...).WithReplyKeyboard()).(tgbotapi.ReplyKeyboardMarkup)
+	if !ok || 3 != len(reply.Keyboard) || "RP" != reply.Keyboard[2][0].Text || !reply.OneTimeKeyboard {
+		t.Errorf("Expected one-time reply keyboard of 3 rows, got %+v", reply)
+	}
+
+	if remove, ok := keyboardOf(bot.NewResponse().WithoutKeyboard()).(tgbotapi.ReplyKeyboardRemove); !ok || !remove.RemoveKeyboard {
+		t.Errorf("Expected keyboard to be removed, got %+v", remove)
+	}
+	if markup := keyboardOf(bot.NewResponse()); nil != markup {
+		t.Errorf("Expected no keyboard, got %+v", markup)
+	}
+}
+
+func TestReplyPacing(t *testing.T) {
+	fake := &fakeBotAPI{}
+	b := &Bot{outbox: newTestOutbox(t, fake, 0, 0)}
+
+	start := time.Now()
+	b.reply(context.Background(), 1, bot.Respond(
+		bot.NewResponse().WithText("That's correct!"),
+		bot.NewResponse().WithTyping(100*time.Millisecond).WithText("Your score is 6"),
+		bot.NewResponse().WithDelay(100*time.Millisecond).WithText("Don't forget to star us!"),
+	))
+	stopOutbox(t, b.outbox)
+
+	calls := fake.Sent()
+	var methods []string
+	for _, c := range calls {
+		methods = append(methods, c.Method+":"+c.Text)
+	}
+	exp := []string{`sendMessage:That's correct\!`, "sendChatAction:", "sendMessage:Your score is 6", `sendMessage:Don't forget to star us\!`}
+	if !reflect.DeepEqual(exp, methods) {
+		t.Fatalf("Expected %v, got %v", exp, methods)
+	}
+	if "typing" != calls[1].Form.Get("action") {
+		t.Errorf("Expected typing action, got %v", calls[1].Form)
+	}
+	if elapsed := calls[2].At.Sub(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected score to be sent after typing, sent in %s", elapsed)
+	}
+	if elapsed := calls[3].At.Sub(calls[2].At); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected last message to be delayed, sent in %s", elapsed)
+	}
+}
+
+func TestReplyFallsBackToText(t *testing.T) {
+	fake := &fakeBotAPI{}
+	b := &Bot{outbox: newTestOutbox(t, fake, 0, 0)}
+
+	//file is removed after the question is loaded
+	image := &bot.Attachment{Kind: bot.AttachmentImage, Name: "widget.png", Path: "/missing/widget.png"}
+	btn := &bot.Button{Text: "Yes", Data: "1"}
+	b.reply(context.Background(), 1, bot.Respond(bot.NewResponse().WithText("What is it?").WithButtons(btn).WithAttachments(image)))
+	stopOutbox(t, b.outbox)
+
+	calls := fake.Sent()
+	if 1 != len(calls) || "sendMessage" != calls[0].Method || "What is it?" != calls[0].Text {
+		t.Fatalf("Expected question to be sent as text, got %v", calls)
+	}
+	if "" == calls[0].Form.Get("reply_markup") {
+		t.Error("Expected answer buttons to be kept")
+	}
+}
+
+func TestPacingOf(t *testing.T) {
+	if rqs := pacingOf(1, bot.NewResponse()); 0 != len(rqs) {
+		t.Errorf("Expected no pacing, got %d requests", len(rqs))
+	}
+	//typing indicator is refreshed while typing lasts
+	rqs := pacingOf(1, bot.NewResponse().WithTyping(typingPeriod*2+time.Second))
+	if 6 != len(rqs) {
+		t.Fatalf("Expected 3 typing actions and delays, got %d requests", len(rqs))
+	}
+	if d, ok := rqs[5].(*delay); !ok || time.Second != d.d {
+		t.Errorf("Expected the last delay to be a second, got %+v", rqs[5])
+	}
+}
@@ -3,16 +3,63 @@ package telegram
 import (
 	"context"
 	"github.com/apex/log"
+	"github.com/avarabyeu/rpquiz/bot/db"
 	"github.com/avarabyeu/rpquiz/bot/engine"
 	"github.com/avarabyeu/rpquiz/bot/engine/ctx"
+	"github.com/avarabyeu/rpquiz/bot/metrics"
+	"github.com/avarabyeu/rpquiz/bot/tracing"
+	"github.com/pkg/errors"
 	"gopkg.in/telegram-bot-api.v4"
 	"strconv"
+	"sync"
+	"time"
 )
 
 //Bot is telegram bot abstraction
 type Bot struct {
 	Token      string
 	Dispatcher *bot.Dispatcher
+	//Workers is a number of updates handled concurrently. Updates of the same user are handled one by one
+	Workers int
+	//QueueSize is a number of updates queued by each worker before polling is paused
+	QueueSize int
+	//Updates keeps the latest handled update, so polling is resumed after restart. Update is committed once
+	//it's handled, so updates in flight are handled again after restart, while their answers are recorded once
+	//since session keeps ID of the update the latest answer is made of. If not set, polling starts from the oldest
+	//unconfirmed update
+	Updates db.UpdateLog
+	//RateLimit is a max number of messages sent per second to all the chats
+	RateLimit float64
+	//ChatRateLimit is a max number of messages sent per second to a single chat
+	ChatRateLimit float64
+	//ChatBurst is a number of messages chat may receive at once before ChatRateLimit applies
+	ChatBurst int
+	//QuizPolls enables rendering of single-answer questions as native quiz polls. Requires Sessions
+	QuizPolls bool
+	//PollOpenPeriod is time user has to answer the poll. Zero means no limit
+	PollOpenPeriod time.Duration
+	//Sessions keeps IDs of the polls sent to the users
+	Sessions db.SessionRepo
+
+	//polls are polls being sent to the users. Closed once poll is saved
+	polls   map[string]chan struct{}
+	pollsMu sync.Mutex
+
+	mu      sync.RWMutex
+	api     *tgbotapi.BotAPI
+	polling bool
+	//polledAt is a time of the last successful response of Telegram
+	polledAt time.Time
+	pool     *bot.WorkerPool
+	outbox   *Outbox
+	tracker  *updateTracker
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	//stopPolling cancels long polling request
+	stopPolling context.CancelFunc
+	//cancel aborts in-flight handlers if they aren't finished in time on stop
+	cancel context.CancelFunc
 }
 
 //Start connects to telegram servers and starts listening
@@ -25,85 +72,279 @@ func (b *Bot) Start() error {
 	//tBot.Debug = true
 
 	log.Debugf("Authorized on account %s", tBot.Self.UserName)
+	if b.Workers < 1 {
+		b.Workers = 8
+	}
+	if b.QueueSize < 1 {
+		b.QueueSize = 16
+	}
+	if b.QuizPolls && nil == b.Sessions {
+		log.Warn("Quiz polls are disabled since sessions aren't available")
+		b.QuizPolls = false
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pollCtx, stopPolling := context.WithCancel(ctx)
+
+	b.mu.Lock()
+	b.api = tBot
+	b.pool = bot.NewWorkerPool(b.Workers, b.QueueSize)
+	b.outbox = NewOutbox(tBot, b.RateLimit, b.ChatRateLimit, b.ChatBurst)
+	b.stop = make(chan struct{})
+	b.done = make(chan struct{})
+	b.stopPolling = stopPolling
+	b.cancel = cancel
+	b.polledAt = time.Now()
+	b.mu.Unlock()
 
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	handled, err := b.handled(ctx)
+	if nil != err {
+		cancel()
+		return errors.Wrap(err, "cannot load telegram update offset")
+	}
+	tracker := newUpdateTracker(handled)
+	b.mu.Lock()
+	b.tracker = tracker
+	b.mu.Unlock()
+	log.Debugf("Polling telegram updates starting from %d", tracker.offset())
 
 	go func() {
-		updates, err := tBot.GetUpdatesChan(u)
-		if nil != err {
-			log.WithError(err).Error(err.Error())
-		}
+		defer close(b.done)
+		b.setPolling(true)
+		defer b.setPolling(false)
 
-		for update := range updates {
-
-			var message string
-			var tMessage *tgbotapi.Message
-			var user string
-			var fullName string
-			var userID string
-
-			callback := false
-
-			if update.Message != nil {
-				message = update.Message.Text
-				tMessage = update.Message
-				user = update.Message.From.UserName
-				fullName = update.Message.From.FirstName + " " + update.Message.From.LastName
-				userID = strconv.Itoa(update.Message.From.ID)
-			} else if update.CallbackQuery != nil {
-				message = update.CallbackQuery.Data
-				tMessage = update.CallbackQuery.Message
-				user = update.CallbackQuery.From.UserName
-				fullName = update.CallbackQuery.From.FirstName + " " + update.CallbackQuery.From.LastName
-				userID = strconv.Itoa(update.CallbackQuery.From.ID)
-				callback = true
-			} else {
+		for {
+			updates, err := getUpdates(pollCtx, tBot.Client, b.Token, tracker.offset())
+			select {
+			case <-b.stop:
+				return
+			default:
+			}
+			if nil != err {
+				log.WithError(err).Error("Failed to get updates, retrying in 3 seconds...")
+				if nil != sleep(pollCtx, 3*time.Second) {
+					return
+				}
 				continue
 			}
+			b.setPolledAt(time.Now())
 
-			if "" != user {
-				log.Debugf("[%s] %s", user, message)
-			} else {
-				user = fullName
+			started := 0
+			for _, u := range updates {
+				if tracker.start(u.UpdateID) {
+					started++
+					b.handle(ctx, u)
+				}
+			}
+			if 0 != len(updates) && 0 == started {
+				//only updates in flight are polled, so there is nothing to do until some of them is handled
+				tracker.wait(pollCtx, inFlightWait)
 			}
-
-			go func(update *tgbotapi.Message) {
-
-				ctx := botctx.WithOriginalMessage(context.Background(), update)
-				ctx = botctx.WithUserName(ctx, user)
-				ctx = botctx.WithUserID(ctx, userID)
-				ctx, cancel := context.WithCancel(ctx)
-				defer cancel()
-				rss := b.Dispatcher.Dispatch(ctx, message, callback)
-				reply(tBot, update, rss)
-			}(tMessage)
-
 		}
 	}()
 	return nil
 
 }
 
-func reply(bot *tgbotapi.BotAPI, m *tgbotapi.Message, rss []*bot.Response) {
-	for _, rs := range rss {
-		msg := tgbotapi.NewMessage(m.Chat.ID, rs.Text)
-		//msg.ReplyToMessageID = m.MessageID
-		msg.ParseMode = "Markdown"
-
-		buttonsCount := len(rs.Buttons)
-		if buttonsCount > 0 {
-			inlineBtns := make([][]tgbotapi.InlineKeyboardButton, buttonsCount)
-			for i, btn := range rs.Buttons {
-				inlineBtns[i] = []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(btn.Text, btn.Data)}
-			}
+//Stop stops polling for updates and waits until in-flight updates are handled.
+//Handlers which aren't finished when context is done are canceled
+func (b *Bot) Stop(ctx context.Context) error {
+	b.mu.RLock()
+	api, pool, outbox := b.api, b.pool, b.outbox
+	b.mu.RUnlock()
+	if nil == api {
+		return nil
+	}
+	defer b.cancel()
 
-			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(inlineBtns...)
+	b.stopOnce.Do(func() {
+		log.Info("Stopping telegram bot.")
+		close(b.stop)
+		b.stopPolling()
+	})
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := pool.Stop(ctx); nil != err {
+		log.WithError(err).Warn("In-flight updates aren't handled in time")
+		return err
+	}
+	if err := outbox.Stop(ctx); nil != err {
+		log.WithError(err).Warn("Queued responses aren't sent in time")
+		return err
+	}
+	return nil
+}
+
+//handle submits update to the worker of the user. Update is finished once it's handled or it turns out to be ignored
+func (b *Bot) handle(baseCtx context.Context, update *update) {
+	var message string
+	var tMessage *tgbotapi.Message
+	var user string
+	var fullName string
+	var userID string
+	var answer *pollAnswer
+	//start is a /start command, may carry deep link parameter
+	var start bool
+	var startParams map[string]string
+
+	callback := false
+
+	if update.Message != nil {
+		message = update.Message.Text
+		tMessage = update.Message
+		user = update.Message.From.UserName
+		fullName = update.Message.From.FirstName + " " + update.Message.From.LastName
+		userID = strconv.Itoa(update.Message.From.ID)
+		if update.Message.IsCommand() && "start" == update.Message.Command() {
+			start = true
+			startParams = bot.ParseDeepLink(update.Message.CommandArguments())
 		}
+	} else if update.CallbackQuery != nil {
+		message = update.CallbackQuery.Data
+		tMessage = update.CallbackQuery.Message
+		user = update.CallbackQuery.From.UserName
+		fullName = update.CallbackQuery.From.FirstName + " " + update.CallbackQuery.From.LastName
+		userID = strconv.Itoa(update.CallbackQuery.From.ID)
+		callback = true
+	} else if b.QuizPolls && nil != update.PollAnswer && nil != update.PollAnswer.User {
+		//answer is resolved by the worker since it requires session
+		answer = update.PollAnswer
+		message = "poll " + answer.PollID
+		user = answer.User.UserName
+		fullName = answer.User.FirstName + " " + answer.User.LastName
+		userID = strconv.Itoa(answer.User.ID)
+		callback = true
+	} else {
+		b.finish(baseCtx, update.UpdateID)
+		return
+	}
+
+	metrics.UpdatesReceived.WithLabelValues("telegram").Inc()
+
+	if "" != user {
+		log.Debugf("[%s] %s", user, message)
+	} else {
+		user = fullName
+	}
 
-		if _, err := bot.Send(msg); nil != err {
-			log.WithError(err).Error(err.Error())
+	updateID := update.UpdateID
+	submitted := b.pool.Submit(userID, func() {
+		defer b.finish(baseCtx, updateID)
+		ctx, span := tracing.StartSpan(baseCtx, "telegram.update")
+		defer span.End()
+
+		ctx = tracing.WithFields(tracing.NewRequest(ctx), log.Fields{
+			"channel":   "telegram",
+			"update_id": updateID,
+			"user_id":   userID,
+		})
+		ctx = botctx.WithChannel(ctx, "telegram")
+		ctx = botctx.WithOriginalMessage(ctx, tMessage)
+		ctx = botctx.WithUserName(ctx, user)
+		ctx = botctx.WithUserID(ctx, userID)
+		ctx = botctx.WithUpdateID(ctx, updateID)
+
+		text, chatID := message, int64(0)
+		if nil != tMessage {
+			chatID = tMessage.Chat.ID
+		}
+		if nil != answer {
+			var ok bool
+			if text, chatID, ok = b.answerOf(ctx, userID, answer); !ok {
+				tracing.Logger(ctx).Debug("Answer to unknown poll is ignored")
+				return
+			}
 		}
+		var rss []*bot.Response
+		if start {
+			rss = b.Dispatcher.DispatchStart(ctx, text, startParams)
+		} else {
+			rss = b.Dispatcher.Dispatch(ctx, text, callback)
+		}
+		b.reply(ctx, chatID, rss)
+	})
+	if !submitted {
+		log.Warnf("Update %d is rejected since bot is stopping", updateID)
+	}
+}
+
+//handled returns ID of the latest update handled before restart
+func (b *Bot) handled(ctx context.Context) (int, error) {
+	if nil == b.Updates {
+		return 0, nil
 	}
+	return b.Updates.Offset(ctx, "telegram")
+}
+
+//finish marks update as handled and commits offset once all the previous updates are handled too.
+//Updates aborted on stop aren't committed, so they are handled again after restart
+func (b *Bot) finish(ctx context.Context, updateID int) {
+	if nil != ctx.Err() {
+		return
+	}
+	handled, advanced := b.tracker.finish(updateID)
+	if !advanced || nil == b.Updates {
+		return
+	}
+	if err := b.Updates.Commit(ctx, "telegram", handled); nil != err {
+		log.WithError(err).Errorf("Cannot commit update %d", handled)
+	}
+}
 
+//Check makes sure bot is authorized and Telegram has responded to polling recently.
+//Telegram isn't called by the check itself, so probes are cheap
+func (b *Bot) Check(ctx context.Context) error {
+	b.mu.RLock()
+	api, polling, polledAt := b.api, b.polling, b.polledAt
+	b.mu.RUnlock()
+
+	if nil == api {
+		return errors.New("bot isn't authorized")
+	}
+	if !polling {
+		return errors.New("bot doesn't poll for updates")
+	}
+	if since := time.Since(polledAt); since > pollStaleAfter {
+		return errors.Errorf("telegram hasn't responded for %s", since.Round(time.Second))
+	}
+	return nil
+}
+
+func (b *Bot) setPolling(polling bool) {
+	b.mu.Lock()
+	b.polling = polling
+	b.mu.Unlock()
+}
+
+func (b *Bot) setPolledAt(t time.Time) {
+	b.mu.Lock()
+	b.polledAt = t
+	b.mu.Unlock()
+}
+
+//reply queues responses to the chat in order, paced by their delays. Questions are sent as quiz polls if enabled
+func (b *Bot) reply(ctx context.Context, chatID int64, rss []*bot.Response) {
+	ctx, span := tracing.StartSpan(ctx, "telegram.reply")
+	defer span.End()
+
+	var rqs []request
+	for _, rs := range rss {
+		rqs = append(rqs, pacingOf(chatID, rs)...)
+		if poll, ok := pollOf(chatID, rs, b.PollOpenPeriod); b.QuizPolls && ok {
+			for _, a := range rs.Attachments {
+				rqs = append(rqs, &message{attachmentOf(chatID, a, "", nil)})
+			}
+			b.pollSent(ctx, botctx.GetUserID(ctx), poll, rs)
+			rqs = append(rqs, poll)
+			continue
+		}
+		rqs = append(rqs, requestsOf(chatID, rs)...)
+	}
+	if !b.outbox.enqueue(ctx, chatID, rqs...) {
+		tracing.Logger(ctx).Warn("Responses are dropped since bot is stopping")
+	}
 }
@@ -0,0 +1,26 @@
+package telegram
+
+import (
+	"context"
+	"gopkg.in/telegram-bot-api.v4"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		name    string
+		bot     *Bot
+		healthy bool
+	}{
+		{"not started", &Bot{}, false},
+		{"not polling", &Bot{api: &tgbotapi.BotAPI{}, polledAt: time.Now()}, false},
+		{"polled recently", &Bot{api: &tgbotapi.BotAPI{}, polling: true, polledAt: time.Now()}, true},
+		{"stale", &Bot{api: &tgbotapi.BotAPI{}, polling: true, polledAt: time.Now().Add(-pollStaleAfter - time.Second)}, false},
+	}
+	for _, c := range cases {
+		if err := c.bot.Check(context.Background()); c.healthy != (nil == err) {
+			t.Errorf("%s: expected healthy to be %v, got error %v", c.name, c.healthy, err)
+		}
+	}
+}
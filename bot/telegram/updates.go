@@ -0,0 +1,158 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/telegram-bot-api.v4"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//pollTimeout is a timeout of long polling in seconds
+	pollTimeout = 60
+	//pollStaleAfter is a time without successful polls after which bot is considered unhealthy.
+	//Idle long poll lasts pollTimeout, so healthy bot always polls more often
+	pollStaleAfter = 2 * pollTimeout * time.Second
+	//inFlightWait is max time polling waits for in-flight updates to be handled once there are no new updates.
+	//Polling isn't blocked for long by a slow handler of some user, while in-flight updates aren't re-polled in a busy loop
+	inFlightWait = 500 * time.Millisecond
+)
+
+type (
+	//update is a Telegram update including types tgbotapi isn't aware of
+	update struct {
+		tgbotapi.Update
+		PollAnswer *pollAnswer `json:"poll_answer"`
+	}
+
+	//pollAnswer is an answer of the user to non-anonymous poll
+	pollAnswer struct {
+		PollID    string         `json:"poll_id"`
+		User      *tgbotapi.User `json:"user"`
+		OptionIDs []int          `json:"option_ids"`
+	}
+
+	//updateTracker tracks updates being handled. Telegram forgets updates before the polled offset,
+	//so polling is continued only from the first update which isn't handled yet. Otherwise updates in flight
+	//are lost if bot is restarted before they are handled
+	updateTracker struct {
+		mu sync.Mutex
+		//handled is ID of the update all the updates up to which are handled
+		handled int
+		//started is ID of the latest update handling of which is started
+		started int
+		//inFlight are IDs of the started updates in the order they are polled. Value is true once update is handled
+		inFlight []int
+		done     map[int]bool
+		//advanced is closed once handled updates offset moves forward
+		advanced chan struct{}
+	}
+)
+
+//newUpdateTracker creates tracker of updates following the handled one
+func newUpdateTracker(handled int) *updateTracker {
+	return &updateTracker{handled: handled, started: handled, done: map[int]bool{}, advanced: make(chan struct{})}
+}
+
+//offset returns ID of the first update to be polled
+func (t *updateTracker) offset() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if 0 == t.handled {
+		return 0
+	}
+	return t.handled + 1
+}
+
+//start marks update as being handled. Returns false if update has been started already, e.g. it's polled again
+//while it's in flight
+func (t *updateTracker) start(updateID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if updateID <= t.started {
+		return false
+	}
+	t.started = updateID
+	t.inFlight = append(t.inFlight, updateID)
+	return true
+}
+
+//finish marks update as handled. Returns ID of the update all the updates up to which are handled
+//and true if it has moved forward
+func (t *updateTracker) finish(updateID int) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[updateID] = true
+
+	advanced := false
+	for 0 != len(t.inFlight) && t.done[t.inFlight[0]] {
+		delete(t.done, t.inFlight[0])
+		t.handled = t.inFlight[0]
+		t.inFlight = t.inFlight[1:]
+		advanced = true
+	}
+	if advanced {
+		close(t.advanced)
+		t.advanced = make(chan struct{})
+	}
+	return t.handled, advanced
+}
+
+//wait waits until some in-flight update is handled, timeout expires or context is done
+func (t *updateTracker) wait(ctx context.Context, timeout time.Duration) {
+	t.mu.Lock()
+	advanced := t.advanced
+	t.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-advanced:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+//getUpdates long-polls updates starting from the offset. Unlike tgbotapi, request is canceled once context is done
+func getUpdates(ctx context.Context, client *http.Client, token string, offset int) ([]*update, error) {
+	params := url.Values{}
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("timeout", strconv.Itoa(pollTimeout))
+
+	rq, err := http.NewRequest(http.MethodPost, fmt.Sprintf(tgbotapi.APIEndpoint, token, "getUpdates"), strings.NewReader(params.Encode()))
+	if nil != err {
+		return nil, err
+	}
+	rq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rs, err := client.Do(rq.WithContext(ctx))
+	if nil != err {
+		return nil, err
+	}
+	defer rs.Body.Close()
+
+	var apiRs tgbotapi.APIResponse
+	if err := json.NewDecoder(rs.Body).Decode(&apiRs); nil != err {
+		return nil, errors.Wrap(err, "cannot decode updates")
+	}
+	if !apiRs.Ok {
+		var params tgbotapi.ResponseParameters
+		if nil != apiRs.Parameters {
+			params = *apiRs.Parameters
+		}
+		return nil, tgbotapi.Error{Message: apiRs.Description, ResponseParameters: params}
+	}
+
+	var updates []*update
+	if err := json.Unmarshal(apiRs.Result, &updates); nil != err {
+		return nil, errors.Wrap(err, "cannot decode updates")
+	}
+	return updates, nil
+}
@@ -0,0 +1,75 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUpdateTracker(t *testing.T) {
+	tracker := newUpdateTracker(0)
+	if 0 != tracker.offset() {
+		t.Errorf("Expected polling from the oldest update, got %d", tracker.offset())
+	}
+
+	for _, id := range []int{10, 11, 12} {
+		if !tracker.start(id) {
+			t.Errorf("Expected update %d to be started", id)
+		}
+	}
+	if tracker.start(11) {
+		t.Error("Update in flight is expected to be skipped once it's polled again")
+	}
+
+	//later update is handled first, so offset stays at the update in flight
+	if _, advanced := tracker.finish(11); advanced {
+		t.Error("Offset isn't expected to move past update in flight")
+	}
+	if 0 != tracker.offset() {
+		t.Errorf("Expected update 10 to be polled again on restart, got offset %d", tracker.offset())
+	}
+
+	if handled, advanced := tracker.finish(10); !advanced || 11 != handled {
+		t.Errorf("Expected updates up to 11 to be handled, got %d", handled)
+	}
+	if 12 != tracker.offset() {
+		t.Errorf("Expected offset 12, got %d", tracker.offset())
+	}
+	if handled, _ := tracker.finish(12); 12 != handled {
+		t.Errorf("Expected updates up to 12 to be handled, got %d", handled)
+	}
+	if 0 != len(tracker.done) {
+		t.Errorf("Expected handled updates to be forgotten, got %v", tracker.done)
+	}
+}
+
+func TestUpdateTrackerResumes(t *testing.T) {
+	tracker := newUpdateTracker(41)
+	if 42 != tracker.offset() {
+		t.Errorf("Expected polling to be resumed from 42, got %d", tracker.offset())
+	}
+	if tracker.start(41) {
+		t.Error("Handled update isn't expected to be started again")
+	}
+}
+
+func TestUpdateTrackerWait(t *testing.T) {
+	tracker := newUpdateTracker(0)
+	tracker.start(1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.finish(1)
+	}()
+
+	started := time.Now()
+	tracker.wait(context.Background(), time.Minute)
+	if time.Since(started) > 10*time.Second {
+		t.Error("Expected wait to be over once update is handled")
+	}
+
+	started = time.Now()
+	tracker.wait(context.Background(), 10*time.Millisecond)
+	if time.Since(started) > 10*time.Second {
+		t.Error("Expected wait to be over on timeout")
+	}
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/apex/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey string
+
+const (
+	loggerKey    contextKey = "logger"
+	requestIDKey contextKey = "requestID"
+)
+
+//NewRequest assigns request ID and request-scoped logger to the context, unless it already has them.
+//Trace ID is used as request ID if tracing is enabled
+func NewRequest(ctx context.Context) context.Context {
+	if "" != RequestID(ctx) {
+		return ctx
+	}
+
+	var id string
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		id = sc.TraceID().String()
+	} else {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); nil != err {
+			log.WithError(err).Warn("Cannot generate request ID")
+		}
+		id = hex.EncodeToString(b)
+	}
+
+	ctx = context.WithValue(ctx, requestIDKey, id)
+	return WithFields(ctx, log.Fields{"request_id": id})
+}
+
+//RequestID takes request ID from the context
+func RequestID(ctx context.Context) string {
+	id, ok := ctx.Value(requestIDKey).(string)
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+//Logger takes request-scoped logger from the context. Falls back to the default logger
+func Logger(ctx context.Context) log.Interface {
+	if l, ok := ctx.Value(loggerKey).(log.Interface); ok {
+		return l
+	}
+	return log.Log
+}
+
+//WithFields adds fields to the request-scoped logger.
+//Fields are also added as attributes to the current span
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	annotate(ctx, fields)
+	return context.WithValue(ctx, loggerKey, Logger(ctx).WithFields(fields))
+}
@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	//ExporterNone disables tracing
+	ExporterNone = "none"
+	//ExporterStdout prints spans to stdout
+	ExporterStdout = "stdout"
+	//ExporterOTLP sends spans to OpenTelemetry collector over HTTP
+	ExporterOTLP = "otlp"
+
+	serviceName = "rpquiz"
+)
+
+//Init configures global tracer provider. Returns function flushing and stopping the exporter
+func Init(ctx context.Context, exporter, endpoint string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+	default:
+		return nil, errors.Errorf("Unknown tracing exporter: %s", exporter)
+	}
+	if nil != err {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	log.Infof("Tracing is enabled. Exporter: %s", exporter)
+
+	return tp.Shutdown, nil
+}
+
+//StartSpan starts new span which is a child of span in the context if any.
+//Noop span is started if tracing isn't enabled
+func StartSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer(serviceName).Start(ctx, name)
+}
+
+//EndSpan records error, if any, and ends the span
+func EndSpan(span trace.Span, err error) {
+	if nil != err {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+//annotate adds log fields as attributes to the current span
+func annotate(ctx context.Context, fields log.Fields) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	for k, v := range fields {
+		span.SetAttributes(attribute.String(k, fmt.Sprint(v)))
+	}
+}
@@ -37,5 +37,10 @@ def index():
     return jsonify(match.__dict__)
 
 
+@application.route('/health', methods=['GET'])
+def health():
+    return jsonify({'status': 'ok'})
+
+
 if __name__ == '__main__':
     application.run(host='0.0.0.0', port=5000)